@@ -31,10 +31,16 @@ func main() {
 	logger := baseLogger.With("component", "server")
 
 	addr := resolveAddr()
+	adminAddr, err := server.AdminAddr(baseLogger.With("component", "config"))
+	if err != nil {
+		logger.Error("invalid admin configuration", "err", err)
+		os.Exit(1)
+	}
+	handlers := server.NewHandlers(server.HandlerConfig{Logger: baseLogger})
 
 	srv := &http.Server{
 		Addr:              addr,
-		Handler:           server.NewHandler(server.HandlerConfig{Logger: baseLogger}),
+		Handler:           handlers.Public,
 		ReadHeaderTimeout: 5 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       60 * time.Second,
@@ -47,6 +53,16 @@ func main() {
 		}
 	}()
 
+	adminSrv := newAdminServer(adminAddr, handlers.Admin)
+	if adminSrv != nil {
+		go func() {
+			logger.Info("admin server listening", "addr", adminSrv.Addr)
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("admin server listen failed", "err", err)
+			}
+		}()
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -59,6 +75,11 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("graceful shutdown failed", "err", err)
 	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("admin server shutdown failed", "err", err)
+		}
+	}
 
 	logger.Info("server stopped")
 }
@@ -106,6 +127,22 @@ func resolveAddr() string {
 	return ":" + port
 }
 
+// newAdminServer returns the server for the admin API, or nil when no admin
+// address is configured. The admin API is never served on the public listener.
+func newAdminServer(addr string, handler http.Handler) *http.Server {
+	if addr == "" || handler == nil {
+		return nil
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+}
+
 func envBool(key string) bool {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -0,0 +1,60 @@
+// Command signaling-broker runs the broker that lets several signaling
+// servers share rooms. Point each server at it with SIGNALING_BROKER_URL.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/logging"
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	flag.Parse()
+
+	baseLogger := logging.Setup(logging.Options{
+		Level:  os.Getenv("LOG_LEVEL"),
+		Format: os.Getenv("LOG_FORMAT"),
+	}).With("service", "rabbit-rtc-broker")
+	logger := baseLogger.With("component", "server")
+
+	secret := strings.TrimSpace(os.Getenv("SIGNALING_BROKER_SECRET"))
+	if secret == "" {
+		logger.Warn("SIGNALING_BROKER_SECRET is not set; accepting unauthenticated nodes")
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           signaling.NewBrokerServer(signaling.BrokerServerConfig{Secret: secret, Logger: baseLogger}),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	go func() {
+		logger.Info("broker listening", "addr", *addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("broker listen failed", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("graceful shutdown failed", "err", err)
+	}
+	logger.Info("broker stopped")
+}
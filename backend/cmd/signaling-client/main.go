@@ -19,11 +19,13 @@ import (
 func main() {
 	endpoint := flag.String("url", "ws://localhost:8080/ws", "WebSocket endpoint URL")
 	room := flag.String("room", "", "room identifier")
-	peer := flag.String("peer", "", "peer identifier")
+	peer := flag.String("peer", "", "peer identifier (omit to let the server assign one)")
+	role := flag.String("role", "", "peer role (broadcaster or viewer)")
+	token := flag.String("token", "", "signed join token")
 	flag.Parse()
 
-	if strings.TrimSpace(*room) == "" || strings.TrimSpace(*peer) == "" {
-		log.Fatal("room and peer flags are required")
+	if strings.TrimSpace(*token) == "" && strings.TrimSpace(*room) == "" {
+		log.Fatal("room flag is required without a token")
 	}
 
 	u, err := url.Parse(*endpoint)
@@ -32,8 +34,11 @@ func main() {
 	}
 
 	q := u.Query()
-	q.Set("room", *room)
-	q.Set("peer", *peer)
+	for key, value := range map[string]string{"room": *room, "peer": *peer, "role": *role, "token": *token} {
+		if strings.TrimSpace(value) != "" {
+			q.Set(key, value)
+		}
+	}
 	u.RawQuery = q.Encode()
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
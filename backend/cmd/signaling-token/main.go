@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+const tokenSecretEnv = "SIGNALING_TOKEN_SECRET"
+
+func main() {
+	room := flag.String("room", "", "room identifier")
+	peer := flag.String("peer", "", "peer identifier (omit to leave the peer ID unbound)")
+	role := flag.String("role", string(signaling.RoleViewer), "peer role (broadcaster or viewer)")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
+	flag.Parse()
+
+	secret := strings.TrimSpace(os.Getenv(tokenSecretEnv))
+	if secret == "" {
+		log.Fatalf("%s must be set", tokenSecretEnv)
+	}
+
+	if strings.TrimSpace(*room) == "" {
+		log.Fatal("room flag is required")
+	}
+
+	if *ttl <= 0 {
+		log.Fatal("ttl must be positive")
+	}
+
+	now := time.Now()
+	token, err := signaling.IssueToken([]byte(secret), signaling.TokenClaims{
+		Room:      strings.TrimSpace(*room),
+		Peer:      strings.TrimSpace(*peer),
+		Role:      signaling.Role(strings.ToLower(strings.TrimSpace(*role))),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(*ttl).Unix(),
+	})
+	if err != nil {
+		log.Fatalf("failed to issue token: %v", err)
+	}
+
+	fmt.Println(token)
+}
@@ -0,0 +1,273 @@
+// Package metrics implements the counters, gauges and histograms exported by
+// the server in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// OtherLabel is the label value a CounterVec with a fixed set of values
+// reports for any other value.
+const OtherLabel = "other"
+
+// Registry holds metric families and writes them in registration order.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+type family struct {
+	name, help, kind string
+	write            func(w *bufio.Writer, name string)
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(name, help, kind string, write func(*bufio.Writer, string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, family{name: name, help: help, kind: kind, write: write})
+}
+
+// WriteTo writes every family in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		bw.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+		bw.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+		f.write(bw, f.name)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc adds one.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add adds n.
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+// Counter registers a counter.
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, "counter", func(w *bufio.Writer, name string) {
+		writeSample(w, name, "", "", float64(c.Value()))
+	})
+	return c
+}
+
+// CounterFunc registers a counter whose value is read from fn at scrape time.
+func (r *Registry) CounterFunc(name, help string, fn func() uint64) {
+	r.register(name, help, "counter", func(w *bufio.Writer, name string) {
+		writeSample(w, name, "", "", float64(fn()))
+	})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at scrape time.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, "gauge", func(w *bufio.Writer, name string) {
+		writeSample(w, name, "", "", fn())
+	})
+}
+
+// GaugeVecFunc registers a gauge with one label whose values are read from
+// fn at scrape time.
+func (r *Registry) GaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.register(name, help, "gauge", func(w *bufio.Writer, name string) {
+		values := fn()
+		for _, value := range sortedKeys(values) {
+			writeSample(w, name, label, value, values[value])
+		}
+	})
+}
+
+// CounterVec is a family of counters partitioned by one label. A CounterVec
+// created with a fixed set of values counts any other value under OtherLabel,
+// so that client supplied values cannot grow it without bound.
+type CounterVec struct {
+	label    string
+	fixed    bool
+	mu       sync.RWMutex
+	counters map[string]*Counter
+}
+
+// CounterVec registers a counter partitioned by label. A nil values leaves
+// the label values unbounded; otherwise only values and OtherLabel are
+// reported, starting at zero.
+func (r *Registry) CounterVec(name, help, label string, values []string) *CounterVec {
+	v := &CounterVec{label: label, fixed: values != nil, counters: make(map[string]*Counter)}
+	for _, value := range values {
+		v.counters[value] = &Counter{}
+	}
+	if v.fixed {
+		v.counters[OtherLabel] = &Counter{}
+	}
+	r.register(name, help, "counter", v.write)
+	return v
+}
+
+// With returns the counter for value.
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.RLock()
+	c, ok := v.counters[value]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+	if v.fixed {
+		// the values of a fixed vec never change after registration
+		return v.counters[OtherLabel]
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.counters[value]; ok {
+		return c
+	}
+	c = &Counter{}
+	v.counters[value] = c
+	return c
+}
+
+func (v *CounterVec) write(w *bufio.Writer, name string) {
+	v.mu.RLock()
+	values := make(map[string]uint64, len(v.counters))
+	for value, c := range v.counters {
+		values[value] = c.Value()
+	}
+	v.mu.RUnlock()
+
+	for _, value := range sortedKeys(values) {
+		writeSample(w, name, v.label, value, float64(values[value]))
+	}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	bounds []float64
+	// counts holds one count per bound plus the +Inf bucket, not cumulated.
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+// Histogram registers a histogram with the given ascending upper bounds.
+func (r *Registry) Histogram(name, help string, bounds []float64) *Histogram {
+	h := &Histogram{
+		bounds: append([]float64(nil), bounds...),
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+	sort.Float64s(h.bounds)
+	r.register(name, help, "histogram", h.write)
+	return h
+}
+
+// Observe records v.
+func (h *Histogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		writeSample(w, name+"_bucket", "le", formatFloat(bound), float64(cumulative))
+	}
+	cumulative += h.counts[len(h.bounds)].Load()
+	writeSample(w, name+"_bucket", "le", "+Inf", float64(cumulative))
+	writeSample(w, name+"_sum", "", "", math.Float64frombits(h.sum.Load()))
+	writeSample(w, name+"_count", "", "", float64(cumulative))
+}
+
+func writeSample(w *bufio.Writer, name, label, value string, v float64) {
+	w.WriteString(name)
+	if label != "" {
+		w.WriteString("{" + label + `="` + escapeLabel(value) + `"}`)
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
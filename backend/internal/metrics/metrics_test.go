@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesTextExposition(t *testing.T) {
+	reg := NewRegistry()
+	joins := reg.Counter("joins_total", "Peers that joined.")
+	reg.GaugeVecFunc("peers", "Connected peers.", "role", func() map[string]float64 {
+		return map[string]float64{"viewer": 2, "broadcaster": 1}
+	})
+	types := reg.CounterVec("messages_total", "Messages by type.", "type", nil)
+	latency := reg.Histogram("write_seconds", "Write latency.", []float64{0.01, 0.1})
+
+	joins.Add(3)
+	types.With("offer").Inc()
+	types.With(`odd"type`).Inc()
+	latency.Observe(0.005)
+	latency.Observe(0.05)
+	latency.Observe(2)
+
+	var b strings.Builder
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	want := `# HELP joins_total Peers that joined.
+# TYPE joins_total counter
+joins_total 3
+# HELP peers Connected peers.
+# TYPE peers gauge
+peers{role="broadcaster"} 1
+peers{role="viewer"} 2
+# HELP messages_total Messages by type.
+# TYPE messages_total counter
+messages_total{type="odd\"type"} 1
+messages_total{type="offer"} 1
+# HELP write_seconds Write latency.
+# TYPE write_seconds histogram
+write_seconds_bucket{le="0.01"} 1
+write_seconds_bucket{le="0.1"} 2
+write_seconds_bucket{le="+Inf"} 3
+write_seconds_sum 2.055
+write_seconds_count 3
+`
+	if got := b.String(); got != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterVecFoldsUnknownValues(t *testing.T) {
+	reg := NewRegistry()
+	types := reg.CounterVec("messages_total", "Messages by type.", "type", []string{"a", "b"})
+
+	types.With("c").Inc()
+	types.With("d").Inc()
+	types.With("a").Inc()
+	types.With("a").Inc()
+
+	if got := types.With("a").Value(); got != 2 {
+		t.Fatalf("expected a to count 2, got %d", got)
+	}
+	if got := types.With(OtherLabel).Value(); got != 2 {
+		t.Fatalf("expected unknown values to share %q with 2, got %d", OtherLabel, got)
+	}
+
+	var out strings.Builder
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	for _, line := range []string{`messages_total{type="b"} 0`, `messages_total{type="other"} 2`} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expected %q in output:\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `type="c"`) {
+		t.Fatalf("unexpected unknown value in output:\n%s", out.String())
+	}
+}
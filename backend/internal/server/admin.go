@@ -0,0 +1,149 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+const (
+	adminRoomsPath     = "/admin/rooms"
+	adminPeersPath     = "/admin/peers"
+	adminRoomPeersPath = "/admin/rooms/{room}/peers"
+	adminKickPath      = "/admin/rooms/{room}/peers/{peer}/kick"
+	adminCloseRoomPath = "/admin/rooms/{room}/close"
+	adminTakeDownPath  = "/admin/rooms/{room}/broadcast/takedown"
+
+	maxAdminBodyBytes = 4 << 10
+)
+
+type kickRequest struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+type closeRoomRequest struct {
+	Message string `json:"message"`
+}
+
+type takeDownRequest struct {
+	Reason string `json:"reason"`
+}
+
+// newAdminHandler serves the operator API and the metrics of hub, and its
+// diagnostics reports when enabled. Every request must present token as a
+// bearer token.
+func newAdminHandler(hub *signaling.Hub, token []byte, diagnostics bool, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, adminHandler(logger, token, http.MethodGet, metricsHandler(logger, hub.WriteMetrics)))
+	if diagnostics {
+		mux.HandleFunc(iceDiagnosticsPath, adminHandler(logger, token, http.MethodGet, diagnosticsHandler(logger, func(r *http.Request) (any, bool) {
+			return hub.ICEReport(r.PathValue("room"))
+		})))
+		mux.HandleFunc(roomHandshakesPath, adminHandler(logger, token, http.MethodGet, diagnosticsHandler(logger, func(r *http.Request) (any, bool) {
+			return hub.HandshakeReport(r.PathValue("room"))
+		})))
+		mux.HandleFunc(handshakesPath, adminHandler(logger, token, http.MethodGet, diagnosticsHandler(logger, func(*http.Request) (any, bool) {
+			return hub.GlobalHandshakeReport()
+		})))
+	}
+	mux.HandleFunc(adminRoomsPath, adminHandler(logger, token, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, logger, hub.Rooms())
+	}))
+	mux.HandleFunc(adminPeersPath, adminHandler(logger, token, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, logger, hub.PeerStats())
+	}))
+	mux.HandleFunc(adminRoomPeersPath, adminHandler(logger, token, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		peers, ok := hub.RoomPeers(r.PathValue("room"))
+		if !ok {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+		writeAdminJSON(w, logger, peers)
+	}))
+	mux.HandleFunc(adminKickPath, adminHandler(logger, token, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		var req kickRequest
+		if !decodeAdminRequest(w, r, &req) {
+			return
+		}
+		room, peer := r.PathValue("room"), r.PathValue("peer")
+		logger.Info("admin kick requested", "room", room, "peer", peer, "code", req.Code, "reason", req.Reason, "remote", r.RemoteAddr)
+		writeAdminResult(w, hub.Kick(room, peer, req.Code, req.Reason))
+	}))
+	mux.HandleFunc(adminCloseRoomPath, adminHandler(logger, token, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		var req closeRoomRequest
+		if !decodeAdminRequest(w, r, &req) {
+			return
+		}
+		room := r.PathValue("room")
+		logger.Info("admin room close requested", "room", room, "remote", r.RemoteAddr)
+		writeAdminResult(w, hub.CloseRoom(room, req.Message))
+	}))
+	mux.HandleFunc(adminTakeDownPath, adminHandler(logger, token, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		var req takeDownRequest
+		if !decodeAdminRequest(w, r, &req) {
+			return
+		}
+		room := r.PathValue("room")
+		logger.Info("admin broadcast takedown requested", "room", room, "reason", req.Reason, "remote", r.RemoteAddr)
+		writeAdminResult(w, hub.TakeDownBroadcast(room, req.Reason))
+	}))
+	return mux
+}
+
+// adminHandler checks the bearer token and the method before calling next.
+func adminHandler(logger *slog.Logger, token []byte, method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		presented, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !bearer || len(token) == 0 || subtle.ConstantTimeCompare([]byte(presented), token) != 1 {
+			logger.Warn("admin request rejected: invalid token", "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != method {
+			logger.Warn("admin invalid method", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decodeAdminRequest decodes the optional JSON body of r into v. It writes a
+// 400 response and reports false when the body is invalid.
+func decodeAdminRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(io.LimitReader(r.Body, maxAdminBodyBytes)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeAdminResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, signaling.ErrRoomNotFound), errors.Is(err, signaling.ErrPeerNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, signaling.ErrNoBroadcaster):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, signaling.ErrInvalidCloseCode), errors.Is(err, signaling.ErrCloseReasonTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, logger *slog.Logger, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("failed to encode admin response", "err", err)
+	}
+}
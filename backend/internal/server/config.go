@@ -0,0 +1,456 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+const (
+	allowedOriginsEnv = "SIGNALING_ALLOWED_ORIGINS"
+	tokenSecretEnv    = "SIGNALING_TOKEN_SECRET"
+
+	rateLimitEnv                = "SIGNALING_RATE_LIMIT"
+	rateLimitTypesEnv           = "SIGNALING_RATE_LIMIT_TYPES"
+	rateLimitMaxViolationsEnv   = "SIGNALING_RATE_LIMIT_MAX_VIOLATIONS"
+	rateLimitViolationWindowEnv = "SIGNALING_RATE_LIMIT_VIOLATION_WINDOW"
+
+	slowConsumerPolicyEnv  = "SIGNALING_SLOW_CONSUMER_POLICY"
+	slowConsumerTimeoutEnv = "SIGNALING_SLOW_CONSUMER_TIMEOUT"
+	sendQueueSizeEnv       = "SIGNALING_SEND_QUEUE_SIZE"
+
+	pingIntervalEnv = "SIGNALING_PING_INTERVAL"
+	pongTimeoutEnv  = "SIGNALING_PONG_TIMEOUT"
+
+	resumeGraceEnv      = "SIGNALING_RESUME_GRACE"
+	resumeBufferSizeEnv = "SIGNALING_RESUME_BUFFER_SIZE"
+
+	duplicatePeerPolicyEnv = "SIGNALING_DUPLICATE_PEER_POLICY"
+	assignPeerIDsEnv       = "SIGNALING_ASSIGN_PEER_IDS"
+	mailboxTTLEnv          = "SIGNALING_MAILBOX_TTL"
+	mailboxSizeEnv         = "SIGNALING_MAILBOX_SIZE"
+	policyFileEnv          = "SIGNALING_POLICY_FILE"
+	diagnosticsEnv         = "SIGNALING_DIAGNOSTICS"
+	slowHandshakeEnv       = "SIGNALING_SLOW_HANDSHAKE"
+
+	brokerURLEnv    = "SIGNALING_BROKER_URL"
+	brokerSecretEnv = "SIGNALING_BROKER_SECRET"
+	nodeIDEnv       = "SIGNALING_NODE_ID"
+
+	adminAddrEnv   = "ADMIN_ADDR"
+	adminTokenEnv  = "ADMIN_TOKEN"
+	rejoinBlockEnv = "ADMIN_REJOIN_BLOCK"
+)
+
+var errAdminTokenRequired = errors.New(adminAddrEnv + " is set but " + adminTokenEnv + " is empty")
+
+func signalingAllowedOrigins(logger *slog.Logger) []string {
+	raw := strings.TrimSpace(os.Getenv(allowedOriginsEnv))
+	if raw == "" {
+		logger.Debug("no signaling origins configured; using defaults")
+		return nil
+	}
+
+	parts := strings.Split(raw, ",")
+	var origins []string
+	for _, part := range parts {
+		trimmed := strings.TrimSpace(part)
+		if trimmed == "" {
+			continue
+		}
+		origins = append(origins, trimmed)
+	}
+
+	if len(origins) > 0 {
+		logger.Debug("configured signaling allowed origins", "origins", origins)
+	}
+
+	return origins
+}
+
+func signalingTokenSecret(logger *slog.Logger) []byte {
+	secret := strings.TrimSpace(os.Getenv(tokenSecretEnv))
+	if secret == "" {
+		logger.Debug("no signaling token secret configured; join tokens disabled")
+		return nil
+	}
+
+	logger.Debug("signaling join tokens enabled")
+	return []byte(secret)
+}
+
+func signalingRateLimit(logger *slog.Logger) signaling.RateLimitConfig {
+	var cfg signaling.RateLimitConfig
+
+	if raw := strings.TrimSpace(os.Getenv(rateLimitEnv)); raw != "" {
+		limit, ok := parseRateLimit(raw)
+		if !ok {
+			logger.Warn("ignoring invalid rate limit", "env", rateLimitEnv, "value", raw)
+		} else {
+			cfg.PerPeer = limit
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(rateLimitTypesEnv)); raw != "" {
+		cfg.PerType = make(map[string]signaling.RateLimit)
+		for _, part := range strings.Split(raw, ",") {
+			msgType, value, found := strings.Cut(strings.TrimSpace(part), "=")
+			limit, ok := parseRateLimit(value)
+			if !found || strings.TrimSpace(msgType) == "" || !ok {
+				logger.Warn("ignoring invalid rate limit", "env", rateLimitTypesEnv, "value", part)
+				continue
+			}
+			cfg.PerType[strings.TrimSpace(msgType)] = limit
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(rateLimitMaxViolationsEnv)); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			logger.Warn("ignoring invalid max violations", "env", rateLimitMaxViolationsEnv, "value", raw)
+		} else {
+			cfg.MaxViolations = n
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(rateLimitViolationWindowEnv)); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			logger.Warn("ignoring invalid violation window", "env", rateLimitViolationWindowEnv, "value", raw)
+		} else {
+			cfg.ViolationWindow = d
+		}
+	}
+
+	logger.Debug("configured signaling rate limit", "per_peer", cfg.PerPeer, "per_type", cfg.PerType, "max_violations", cfg.MaxViolations)
+	return cfg
+}
+
+// parseRateLimit parses "rate:burst" (frames per second and bucket size).
+// The burst defaults to the rate when omitted.
+func parseRateLimit(raw string) (signaling.RateLimit, bool) {
+	rateText, burstText, hasBurst := strings.Cut(strings.TrimSpace(raw), ":")
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateText), 64)
+	if err != nil || rate <= 0 {
+		return signaling.RateLimit{}, false
+	}
+
+	burst := int(rate)
+	if hasBurst {
+		burst, err = strconv.Atoi(strings.TrimSpace(burstText))
+		if err != nil || burst <= 0 {
+			return signaling.RateLimit{}, false
+		}
+	}
+
+	return signaling.RateLimit{Rate: rate, Burst: burst}, true
+}
+
+func signalingSlowConsumer(logger *slog.Logger) signaling.SlowConsumerConfig {
+	var cfg signaling.SlowConsumerConfig
+
+	if raw := strings.TrimSpace(os.Getenv(slowConsumerPolicyEnv)); raw != "" {
+		policy, ok := signaling.ParseSlowConsumerPolicy(raw)
+		if !ok {
+			logger.Warn("ignoring invalid slow consumer policy", "env", slowConsumerPolicyEnv, "value", raw)
+		} else {
+			cfg.Policy = policy
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(slowConsumerTimeoutEnv)); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			logger.Warn("ignoring invalid slow consumer timeout", "env", slowConsumerTimeoutEnv, "value", raw)
+		} else {
+			cfg.BlockTimeout = d
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(sendQueueSizeEnv)); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			logger.Warn("ignoring invalid send queue size", "env", sendQueueSizeEnv, "value", raw)
+		} else {
+			cfg.QueueSize = n
+		}
+	}
+
+	logger.Debug("configured slow consumer policy", "policy", cfg.Policy, "timeout", cfg.BlockTimeout, "queue_size", cfg.QueueSize)
+	return cfg
+}
+
+func signalingKeepalive(logger *slog.Logger) signaling.KeepaliveConfig {
+	var cfg signaling.KeepaliveConfig
+
+	if raw := strings.TrimSpace(os.Getenv(pingIntervalEnv)); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			logger.Warn("ignoring invalid ping interval", "env", pingIntervalEnv, "value", raw)
+		} else if d == 0 {
+			cfg.PingInterval = -1
+		} else {
+			cfg.PingInterval = d
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(pongTimeoutEnv)); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			logger.Warn("ignoring invalid pong timeout", "env", pongTimeoutEnv, "value", raw)
+		} else {
+			cfg.PongTimeout = d
+		}
+	}
+
+	logger.Debug("configured signaling keepalive", "ping_interval", cfg.PingInterval, "pong_timeout", cfg.PongTimeout)
+	return cfg
+}
+
+func signalingResume(logger *slog.Logger) signaling.ResumeConfig {
+	var cfg signaling.ResumeConfig
+
+	if raw := strings.TrimSpace(os.Getenv(resumeGraceEnv)); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			logger.Warn("ignoring invalid resume grace", "env", resumeGraceEnv, "value", raw)
+		} else {
+			cfg.Grace = d
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(resumeBufferSizeEnv)); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			logger.Warn("ignoring invalid resume buffer size", "env", resumeBufferSizeEnv, "value", raw)
+		} else {
+			cfg.BufferSize = n
+		}
+	}
+
+	logger.Debug("configured session resumption", "grace", cfg.Grace, "buffer_size", cfg.BufferSize)
+	return cfg
+}
+
+// signalingDuplicatePeer parses a default policy and/or role=policy entries,
+// e.g. "suffix,broadcaster=replace".
+func signalingDuplicatePeer(logger *slog.Logger) signaling.DuplicatePeerConfig {
+	var cfg signaling.DuplicatePeerConfig
+
+	raw := strings.TrimSpace(os.Getenv(duplicatePeerPolicyEnv))
+	if raw == "" {
+		return cfg
+	}
+
+	for _, part := range strings.Split(raw, ",") {
+		key, value, hasRole := strings.Cut(strings.TrimSpace(part), "=")
+		if !hasRole {
+			value = key
+		}
+
+		policy, ok := signaling.ParseDuplicatePeerPolicy(value)
+		if !ok {
+			logger.Warn("ignoring invalid duplicate peer policy", "env", duplicatePeerPolicyEnv, "value", part)
+			continue
+		}
+
+		if !hasRole {
+			cfg.Default = policy
+			continue
+		}
+
+		role := signaling.Role(strings.ToLower(strings.TrimSpace(key)))
+		if role != signaling.RoleBroadcaster && role != signaling.RoleViewer {
+			logger.Warn("ignoring duplicate peer policy for unknown role", "env", duplicatePeerPolicyEnv, "value", part)
+			continue
+		}
+		if cfg.PerRole == nil {
+			cfg.PerRole = make(map[signaling.Role]signaling.DuplicatePeerPolicy)
+		}
+		cfg.PerRole[role] = policy
+	}
+
+	logger.Debug("configured duplicate peer policy", "default", cfg.Default, "per_role", cfg.PerRole)
+	return cfg
+}
+
+func signalingAssignPeerIDs(logger *slog.Logger) bool {
+	raw := strings.TrimSpace(os.Getenv(assignPeerIDsEnv))
+	if raw == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		logger.Warn("ignoring invalid boolean", "env", assignPeerIDsEnv, "value", raw)
+		return false
+	}
+
+	logger.Debug("configured server-assigned peer ids", "enabled", enabled)
+	return enabled
+}
+
+func signalingMailbox(logger *slog.Logger) signaling.MailboxConfig {
+	var cfg signaling.MailboxConfig
+
+	if raw := strings.TrimSpace(os.Getenv(mailboxTTLEnv)); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			logger.Warn("ignoring invalid mailbox ttl", "env", mailboxTTLEnv, "value", raw)
+		} else {
+			cfg.TTL = d
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(mailboxSizeEnv)); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			logger.Warn("ignoring invalid mailbox size", "env", mailboxSizeEnv, "value", raw)
+		} else {
+			cfg.Size = n
+		}
+	}
+
+	logger.Debug("configured mailbox", "ttl", cfg.TTL, "size", cfg.Size)
+	return cfg
+}
+
+// signalingPolicies loads the per-room media policies from a JSON file.
+func signalingPolicies(logger *slog.Logger) signaling.PolicyConfig {
+	path := strings.TrimSpace(os.Getenv(policyFileEnv))
+	if path == "" {
+		return signaling.PolicyConfig{}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Warn("ignoring unreadable policy file", "env", policyFileEnv, "path", path, "err", err)
+		return signaling.PolicyConfig{}
+	}
+
+	cfg, err := signaling.ParsePolicyConfig(data)
+	if err != nil {
+		logger.Warn("ignoring invalid policy file", "env", policyFileEnv, "path", path, "err", err)
+		return signaling.PolicyConfig{}
+	}
+
+	logger.Debug("configured room policies", "path", path, "rooms", len(cfg.Rooms))
+	return cfg
+}
+
+func signalingDiagnostics(logger *slog.Logger) bool {
+	raw := strings.TrimSpace(os.Getenv(diagnosticsEnv))
+	if raw == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		logger.Warn("ignoring invalid boolean", "env", diagnosticsEnv, "value", raw)
+		return false
+	}
+
+	logger.Debug("configured signaling diagnostics", "enabled", enabled)
+	return enabled
+}
+
+func signalingSlowHandshake(logger *slog.Logger) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(slowHandshakeEnv))
+	if raw == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		logger.Warn("ignoring invalid slow handshake threshold", "env", slowHandshakeEnv, "value", raw)
+		return 0
+	}
+	if d == 0 {
+		d = -1
+	}
+
+	logger.Debug("configured slow handshake threshold", "threshold", d)
+	return d
+}
+
+func signalingRejoinBlock(logger *slog.Logger) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(rejoinBlockEnv))
+	if raw == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		logger.Warn("ignoring invalid rejoin block", "env", rejoinBlockEnv, "value", raw)
+		return 0
+	}
+	if d == 0 {
+		d = -1
+	}
+
+	logger.Debug("configured rejoin block", "block", d)
+	return d
+}
+
+// signalingBroker connects to the broker server shared by the replicas, if
+// one is configured.
+func signalingBroker(logger, baseLogger *slog.Logger) signaling.Broker {
+	url := strings.TrimSpace(os.Getenv(brokerURLEnv))
+	if url == "" {
+		return nil
+	}
+
+	logger.Debug("configured signaling broker", "url", url)
+	return signaling.NewRemoteBroker(signaling.RemoteBrokerConfig{
+		URL:    url,
+		Secret: strings.TrimSpace(os.Getenv(brokerSecretEnv)),
+		Logger: baseLogger,
+	})
+}
+
+func signalingNodeID(logger *slog.Logger) string {
+	node := strings.TrimSpace(os.Getenv(nodeIDEnv))
+	if node != "" {
+		logger.Debug("configured signaling node id", "node", node)
+	}
+	return node
+}
+
+func adminToken(logger *slog.Logger) []byte {
+	token := strings.TrimSpace(os.Getenv(adminTokenEnv))
+	if token == "" {
+		logger.Debug("no admin token configured; admin API and metrics disabled")
+		return nil
+	}
+
+	logger.Debug("admin API enabled")
+	return []byte(token)
+}
+
+// AdminAddr returns the listen address of the admin API from ADMIN_ADDR, or
+// an empty string when it is not set. It fails when the address is invalid
+// or ADMIN_TOKEN is missing, since the admin listener could not serve it.
+func AdminAddr(logger *slog.Logger) (string, error) {
+	addr := strings.TrimSpace(os.Getenv(adminAddrEnv))
+	if addr == "" {
+		logger.Debug("no admin address configured; admin listener disabled")
+		return "", nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", fmt.Errorf("invalid %s %q: %w", adminAddrEnv, addr, err)
+	}
+	if strings.TrimSpace(os.Getenv(adminTokenEnv)) == "" {
+		return "", errAdminTokenRequired
+	}
+
+	logger.Debug("configured admin address", "addr", addr)
+	return addr, nil
+}
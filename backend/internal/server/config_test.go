@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdminAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "disabled", addr: "", token: "", want: ""},
+		{name: "token without address", addr: "", token: "secret", want: ""},
+		{name: "address with token", addr: " 127.0.0.1:9090 ", token: "secret", want: "127.0.0.1:9090"},
+		{name: "address without token", addr: "127.0.0.1:9090", token: "", wantErr: true},
+		{name: "invalid address", addr: "localhost", token: "secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(adminAddrEnv, tt.addr)
+			t.Setenv(adminTokenEnv, tt.token)
+
+			got, err := AdminAddr(newTestLogger())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got address %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected address %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAdminAddrRequiresToken(t *testing.T) {
+	t.Setenv(adminAddrEnv, "127.0.0.1:9090")
+	t.Setenv(adminTokenEnv, "  ")
+
+	if _, err := AdminAddr(newTestLogger()); !errors.Is(err, errAdminTokenRequired) {
+		t.Fatalf("expected errAdminTokenRequired, got %v", err)
+	}
+}
@@ -1,20 +1,24 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
-	"os"
-	"strings"
 	"time"
 
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/metrics"
 	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
 )
 
 const (
-	healthzPath       = "/healthz"
-	signalingPath     = "/ws"
-	allowedOriginsEnv = "SIGNALING_ALLOWED_ORIGINS"
+	healthzPath        = "/healthz"
+	metricsPath        = "/metrics"
+	signalingPath      = "/ws"
+	iceDiagnosticsPath = "/diagnostics/rooms/{room}/ice"
+	roomHandshakesPath = "/diagnostics/rooms/{room}/handshakes"
+	handshakesPath     = "/diagnostics/handshakes"
 )
 
 var serverStart = time.Now()
@@ -23,7 +27,23 @@ type HandlerConfig struct {
 	Logger *slog.Logger
 }
 
+// Handlers are the HTTP handlers sharing one signaling hub.
+type Handlers struct {
+	// Public serves the signaling endpoints.
+	Public http.Handler
+	// Admin serves the operator API, the metrics and the diagnostics
+	// reports. It is nil
+	// unless ADMIN_TOKEN is set, and must be served on a listener that is not
+	// exposed to the internet.
+	Admin http.Handler
+}
+
+// NewHandler returns the public handler of NewHandlers.
 func NewHandler(cfg HandlerConfig) http.Handler {
+	return NewHandlers(cfg).Public
+}
+
+func NewHandlers(cfg HandlerConfig) Handlers {
 	logger := cfg.Logger
 	if logger == nil {
 		logger = slog.Default()
@@ -34,12 +54,37 @@ func NewHandler(cfg HandlerConfig) http.Handler {
 	mux.HandleFunc(healthzPath, healthHandler(httpLogger))
 
 	configLogger := logger.With("component", "config")
+	diagnostics := signalingDiagnostics(configLogger)
 	hub := signaling.NewHub(signaling.HubConfig{
 		AllowedOrigins: signalingAllowedOrigins(configLogger),
+		TokenSecret:    signalingTokenSecret(configLogger),
+		RateLimit:      signalingRateLimit(configLogger),
+		SlowConsumer:   signalingSlowConsumer(configLogger),
+		Keepalive:      signalingKeepalive(configLogger),
+		Resume:         signalingResume(configLogger),
+		DuplicatePeer:  signalingDuplicatePeer(configLogger),
+		AssignPeerIDs:  signalingAssignPeerIDs(configLogger),
+		Mailbox:        signalingMailbox(configLogger),
+		Policies:       signalingPolicies(configLogger),
+		Diagnostics:    diagnostics,
+		SlowHandshake:  signalingSlowHandshake(configLogger),
+		RejoinBlock:    signalingRejoinBlock(configLogger),
+		Broker:         signalingBroker(configLogger, logger),
+		NodeID:         signalingNodeID(configLogger),
 		Logger:         logger,
 	})
 	mux.HandleFunc(signalingPath, hub.ServeWS)
-	return mux
+
+	handlers := Handlers{Public: mux}
+	token := adminToken(configLogger)
+	if len(token) == 0 {
+		if diagnostics {
+			configLogger.Warn("diagnostics are recorded but not served without an admin token", "env", adminTokenEnv)
+		}
+		return handlers
+	}
+	handlers.Admin = newAdminHandler(hub, token, diagnostics, logger.With("component", "admin"))
+	return handlers
 }
 
 type healthResponse struct {
@@ -71,26 +116,52 @@ func healthHandler(logger *slog.Logger) http.HandlerFunc {
 	}
 }
 
-func signalingAllowedOrigins(logger *slog.Logger) []string {
-	raw := strings.TrimSpace(os.Getenv(allowedOriginsEnv))
-	if raw == "" {
-		logger.Debug("no signaling origins configured; using defaults")
-		return nil
-	}
+// metricsHandler serves the metrics written by write in the Prometheus text
+// exposition format.
+func metricsHandler(logger *slog.Logger, write func(io.Writer) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			logger.Warn("metrics invalid method", "method", r.Method, "remote", r.RemoteAddr)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
 
-	parts := strings.Split(raw, ",")
-	var origins []string
-	for _, part := range parts {
-		trimmed := strings.TrimSpace(part)
-		if trimmed == "" {
-			continue
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			logger.Error("failed to write metrics", "err", err)
+			http.Error(w, "failed to write metrics", http.StatusInternalServerError)
+			return
 		}
-		origins = append(origins, trimmed)
-	}
 
-	if len(origins) > 0 {
-		logger.Debug("configured signaling allowed origins", "origins", origins)
+		w.Header().Set("Content-Type", metrics.ContentType)
+		_, _ = w.Write(buf.Bytes())
+		logger.Debug("metrics responded", "remote", r.RemoteAddr)
 	}
+}
 
-	return origins
+// diagnosticsHandler serves the JSON report returned by report, or 404 when
+// it reports false.
+func diagnosticsHandler(logger *slog.Logger, report func(*http.Request) (any, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			logger.Warn("diagnostics invalid method", "method", r.Method, "remote", r.RemoteAddr)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp, ok := report(r)
+		if !ok {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Error("failed to encode diagnostics response", "err", err)
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Debug("diagnostics responded", "path", r.URL.Path, "remote", r.RemoteAddr)
+	}
 }
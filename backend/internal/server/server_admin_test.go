@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+const testAdminToken = "admin-secret"
+
+// newAdminTestServers starts the public and admin listeners of one hub.
+func newAdminTestServers(t *testing.T) (public, admin *httptest.Server) {
+	t.Helper()
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(adminTokenEnv, testAdminToken)
+
+	handlers := NewHandlers(HandlerConfig{Logger: newTestLogger()})
+	if handlers.Admin == nil {
+		t.Fatalf("expected admin handler when %s is set", adminTokenEnv)
+	}
+	public = httptest.NewServer(handlers.Public)
+	t.Cleanup(public.Close)
+	admin = httptest.NewServer(handlers.Admin)
+	t.Cleanup(admin.Close)
+	return public, admin
+}
+
+func adminRequest(t *testing.T, srv *httptest.Server, method, path string, body interface{}) *http.Response {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		reader = bytes.NewReader(mustJSON(t, body))
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// readUntilClose reads frames until the connection is closed and returns the
+// close error along with the types of the frames read before it.
+func readUntilClose(t *testing.T, conn *websocket.Conn) (*websocket.CloseError, []string) {
+	t.Helper()
+
+	var types []string
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("failed to set read deadline: %v", err)
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("expected close frame, got %v", err)
+			}
+			return closeErr, types
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		types = append(types, msg["type"].(string))
+	}
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	t.Setenv(adminTokenEnv, "")
+
+	if handlers := NewHandlers(HandlerConfig{Logger: newTestLogger()}); handlers.Admin != nil {
+		t.Fatalf("expected no admin handler without %s", adminTokenEnv)
+	}
+}
+
+func TestAdminRejectsMissingOrInvalidToken(t *testing.T) {
+	_, admin := newAdminTestServers(t)
+
+	for _, header := range []string{"", "Bearer wrong", testAdminToken} {
+		req, err := http.NewRequest(http.MethodGet, admin.URL+adminRoomsPath, nil)
+		if err != nil {
+			t.Fatalf("failed to build request: %v", err)
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("admin request failed: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected status %d for %q, got %d", http.StatusUnauthorized, header, res.StatusCode)
+		}
+	}
+}
+
+func TestAdminListsRoomsAndPeers(t *testing.T) {
+	public, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, public.URL, "admin-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+	bob := dialWebSocket(t, public.URL, "admin-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	res := adminRequest(t, admin, http.MethodGet, adminRoomsPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	var rooms []signaling.RoomSummary
+	if err := json.NewDecoder(res.Body).Decode(&rooms); err != nil {
+		t.Fatalf("failed to decode rooms: %v", err)
+	}
+	want := []signaling.RoomSummary{{Room: "admin-room", Peers: 2, Broadcaster: "alice"}}
+	if len(rooms) != 1 || rooms[0] != want[0] {
+		t.Fatalf("expected rooms %+v, got %+v", want, rooms)
+	}
+
+	res = adminRequest(t, admin, http.MethodGet, "/admin/rooms/admin-room/peers", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	var peers []signaling.PeerStats
+	if err := json.NewDecoder(res.Body).Decode(&peers); err != nil {
+		t.Fatalf("failed to decode peers: %v", err)
+	}
+	if len(peers) != 2 || peers[0].Peer != "alice" || peers[1].Peer != "bob" {
+		t.Fatalf("expected alice and bob, got %+v", peers)
+	}
+	for _, p := range peers {
+		if !strings.HasPrefix(p.RemoteAddr, "127.0.0.1:") {
+			t.Fatalf("expected remote address of %s, got %q", p.Peer, p.RemoteAddr)
+		}
+		if time.Since(p.ConnectedAt) > time.Minute {
+			t.Fatalf("expected recent connect time of %s, got %v", p.Peer, p.ConnectedAt)
+		}
+	}
+
+	if res := adminRequest(t, admin, http.MethodGet, "/admin/rooms/missing/peers", nil); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d for unknown room, got %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	carol := dialWebSocket(t, public.URL, "other-room", "carol", "viewer")
+	defer closeConn(t, carol)
+
+	res = adminRequest(t, admin, http.MethodGet, adminPeersPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	var raw []map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		t.Fatalf("failed to decode peers: %v", err)
+	}
+	var got []string
+	for _, p := range raw {
+		if _, ok := p["rttMs"].(float64); !ok {
+			t.Fatalf("expected rttMs in milliseconds, got %v", p)
+		}
+		got = append(got, fmt.Sprintf("%v/%v", p["room"], p["peer"]))
+	}
+	if want := "admin-room/alice admin-room/bob other-room/carol"; strings.Join(got, " ") != want {
+		t.Fatalf("expected peers %q, got %q", want, strings.Join(got, " "))
+	}
+}
+
+// expectRejoinBlocked dials room as peer and expects the join to be refused
+// because an operator removed the peer.
+func expectRejoinBlocked(t *testing.T, baseURL, room, peer, role string) {
+	t.Helper()
+
+	conn := dialWebSocketQuery(t, baseURL, url.Values{"room": {room}, "peer": {peer}, "role": {role}})
+	defer conn.Close()
+	closeErr, types := readUntilClose(t, conn)
+	if closeErr.Code != websocket.ClosePolicyViolation || len(types) != 0 {
+		t.Fatalf("expected rejoin of %s to be refused, got close %d after %v", peer, closeErr.Code, types)
+	}
+}
+
+func TestAdminKicksPeerWithCodeAndReason(t *testing.T) {
+	public, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, public.URL, "kick-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+	bob := dialWebSocket(t, public.URL, "kick-room", "bob", "viewer")
+	defer closeConn(t, bob)
+	if msg := readJSON(t, alice); msg["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", msg["type"])
+	}
+
+	if res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/kick-room/peers/bob/kick", map[string]interface{}{"code": 1005}); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d for reserved close code, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+	if res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/kick-room/peers/carol/kick", nil); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d for unknown peer, got %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/kick-room/peers/bob/kick", map[string]interface{}{"code": 4100, "reason": "spam"})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	closeErr, _ := readUntilClose(t, bob)
+	if closeErr.Code != 4100 || closeErr.Text != "spam" {
+		t.Fatalf("expected close 4100 spam, got %d %q", closeErr.Code, closeErr.Text)
+	}
+	if msg := readJSON(t, alice); msg["type"] != "peer-left" {
+		t.Fatalf("expected peer-left, got %v", msg["type"])
+	}
+
+	expectRejoinBlocked(t, public.URL, "kick-room", "bob", "viewer")
+	carol := dialWebSocket(t, public.URL, "kick-room", "carol", "viewer")
+	closeConn(t, carol)
+}
+
+func TestAdminRejoinBlockCanBeDisabled(t *testing.T) {
+	t.Setenv(rejoinBlockEnv, "0")
+	public, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, public.URL, "unblocked-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+	bob := dialWebSocket(t, public.URL, "unblocked-room", "bob", "viewer")
+
+	if res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/unblocked-room/peers/bob/kick", nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, res.StatusCode)
+	}
+	if closeErr, _ := readUntilClose(t, bob); closeErr.Code != signaling.CloseKicked {
+		t.Fatalf("expected close %d, got %d", signaling.CloseKicked, closeErr.Code)
+	}
+
+	bob = dialWebSocket(t, public.URL, "unblocked-room", "bob", "viewer")
+	closeConn(t, bob)
+}
+
+func TestAdminClosesRoomWithMessage(t *testing.T) {
+	public, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, public.URL, "closing-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+	bob := dialWebSocket(t, public.URL, "closing-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/closing-room/close", map[string]string{"message": "maintenance"})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	msg := readJSON(t, bob)
+	if msg["type"] != "room-closed" {
+		t.Fatalf("expected room-closed, got %v", msg["type"])
+	}
+	if payload, _ := msg["payload"].(map[string]interface{}); payload["message"] != "maintenance" {
+		t.Fatalf("expected maintenance message, got %v", msg["payload"])
+	}
+	if closeErr, _ := readUntilClose(t, bob); closeErr.Code != signaling.CloseRoomClosed {
+		t.Fatalf("expected close %d, got %d", signaling.CloseRoomClosed, closeErr.Code)
+	}
+
+	closeErr, types := readUntilClose(t, alice)
+	if closeErr.Code != signaling.CloseRoomClosed {
+		t.Fatalf("expected close %d, got %d", signaling.CloseRoomClosed, closeErr.Code)
+	}
+	if len(types) == 0 || types[len(types)-1] != "room-closed" {
+		t.Fatalf("expected room-closed before the close frame, got %v", types)
+	}
+
+	expectRejoinBlocked(t, public.URL, "closing-room", "alice", "broadcaster")
+	carol := dialWebSocket(t, public.URL, "closing-room", "carol", "broadcaster")
+	closeConn(t, carol)
+}
+
+func TestAdminTakesDownBroadcast(t *testing.T) {
+	public, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, public.URL, "takedown-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+	bob := dialWebSocket(t, public.URL, "takedown-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/takedown-room/broadcast/takedown", map[string]string{"reason": "terms violation"})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	closeErr, _ := readUntilClose(t, alice)
+	if closeErr.Code != signaling.CloseBroadcastTakenDown || closeErr.Text != "terms violation" {
+		t.Fatalf("expected close %d, got %d %q", signaling.CloseBroadcastTakenDown, closeErr.Code, closeErr.Text)
+	}
+
+	msg := readJSON(t, bob)
+	if msg["type"] != "broadcast-ended" {
+		t.Fatalf("expected broadcast-ended, got %v", msg["type"])
+	}
+	if payload, _ := msg["payload"].(map[string]interface{}); payload["peer"] != "alice" || payload["reason"] != "terms violation" {
+		t.Fatalf("unexpected broadcast-ended payload %v", msg["payload"])
+	}
+	for _, want := range []string{"peer-left", "broadcaster-left"} {
+		if msg := readJSON(t, bob); msg["type"] != want {
+			t.Fatalf("expected %s, got %v", want, msg["type"])
+		}
+	}
+
+	if res := adminRequest(t, admin, http.MethodPost, "/admin/rooms/takedown-room/broadcast/takedown", nil); res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status %d without a broadcaster, got %d", http.StatusConflict, res.StatusCode)
+	}
+
+	expectRejoinBlocked(t, public.URL, "takedown-room", "alice", "broadcaster")
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+// newClusterNode starts a signaling server that shares its rooms through the
+// broker at brokerURL.
+func newClusterNode(t *testing.T, brokerURL, node string) *httptest.Server {
+	t.Helper()
+
+	t.Setenv(brokerURLEnv, brokerURL)
+	t.Setenv(brokerSecretEnv, "cluster-secret")
+	t.Setenv(nodeIDEnv, node)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketClusterSharesRoomsAcrossNodes(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	broker := httptest.NewServer(signaling.NewBrokerServer(signaling.BrokerServerConfig{
+		Secret: "cluster-secret",
+		Logger: newTestLogger(),
+	}))
+	t.Cleanup(broker.Close)
+	brokerURL := "ws" + strings.TrimPrefix(broker.URL, "http")
+
+	nodeA := newClusterNode(t, brokerURL, "node-a")
+	nodeB := newClusterNode(t, brokerURL, "node-b")
+
+	alice := dialWebSocket(t, nodeA.URL, "cluster-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocketQuery(t, nodeB.URL, url.Values{"room": {"cluster-room"}, "peer": {"bob"}, "role": {"viewer"}})
+	welcome := readJSON(t, bob)
+	payload, _ := welcome["payload"].(map[string]interface{})
+	peers, _ := payload["peers"].([]interface{})
+	if len(peers) != 1 {
+		t.Fatalf("expected alice in the roster of node b, got %v", payload["peers"])
+	}
+	if entry, _ := peers[0].(map[string]interface{}); entry["id"] != "alice" || entry["role"] != "broadcaster" {
+		t.Fatalf("expected broadcaster alice in roster, got %v", peers[0])
+	}
+
+	joined := readJSON(t, alice)
+	if joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined on node a, got %v", joined)
+	}
+	if payload, _ := joined["payload"].(map[string]interface{}); payload["peer"] != "bob" {
+		t.Fatalf("expected peer-joined for bob, got %v", joined["payload"])
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload("cluster-offer")})
+	offer := readJSON(t, bob)
+	if offer["type"] != "offer" || offer["from"] != "alice" {
+		t.Fatalf("expected offer from alice, got %v", offer)
+	}
+
+	writeJSON(t, bob, map[string]interface{}{"type": "answer", "to": "alice", "payload": map[string]string{"type": "answer", "sdp": "cluster-answer"}})
+	if answer := readJSON(t, alice); answer["type"] != "answer" || answer["from"] != "bob" {
+		t.Fatalf("expected answer from bob, got %v", answer)
+	}
+
+	for _, attempt := range []url.Values{
+		{"room": {"cluster-room"}, "peer": {"alice"}, "role": {"viewer"}},
+		{"room": {"cluster-room"}, "peer": {"carol"}, "role": {"broadcaster"}},
+	} {
+		conn := dialWebSocketQuery(t, nodeB.URL, attempt)
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("failed to set read deadline: %v", err)
+		}
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Fatalf("expected policy violation close for %v, got %v", attempt, err)
+		}
+		_ = conn.Close()
+	}
+
+	closeConn(t, bob)
+
+	left := readJSON(t, alice)
+	if left["type"] != "peer-left" {
+		t.Fatalf("expected peer-left on node a, got %v", left)
+	}
+	if payload, _ := left["payload"].(map[string]interface{}); payload["peer"] != "bob" {
+		t.Fatalf("expected peer-left for bob, got %v", left["payload"])
+	}
+}
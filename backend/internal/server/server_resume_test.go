@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketResumeReplaysMissedMessages(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(resumeGraceEnv, "2s")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "resume-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	query := url.Values{"room": {"resume-room"}, "peer": {"bob"}, "role": {"viewer"}}
+	bob := dialWebSocketQuery(t, srv.URL, query)
+	token := resumeToken(t, readJSON(t, bob))
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	// drop the socket without a close frame, as a network blip would
+	_ = bob.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	for _, seq := range []int{1, 2} {
+		writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload(fmt.Sprintf("seq-%d", seq))})
+	}
+
+	query.Set("resume", token)
+	resumed := dialWebSocketQuery(t, srv.URL, query)
+	defer closeConn(t, resumed)
+
+	welcome := readJSON(t, resumed)
+	if payload, _ := welcome["payload"].(map[string]interface{}); welcome["type"] != "welcome" || payload["resumed"] != true {
+		t.Fatalf("expected resumed welcome, got %v", welcome)
+	}
+
+	for _, want := range []string{"seq-1", "seq-2"} {
+		msg := readJSON(t, resumed)
+		payload, _ := msg["payload"].(map[string]interface{})
+		if msg["type"] != "offer" || payload["sdp"] != want {
+			t.Fatalf("expected replayed offer %v, got %v", want, msg)
+		}
+	}
+
+	if err := alice.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, data, err := alice.ReadMessage(); err == nil {
+		t.Fatalf("expected no presence change for alice, got %s", data)
+	}
+}
+
+func TestWebSocketResumeRequiresToken(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(resumeGraceEnv, "2s")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	bob := dialWebSocket(t, srv.URL, "held-room", "bob", "viewer")
+	_ = bob.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	query := url.Values{"room": {"held-room"}, "peer": {"bob"}, "role": {"viewer"}, "resume": {"bogus"}}
+	intruder := dialWebSocketQuery(t, srv.URL, query)
+	defer closeConn(t, intruder)
+
+	if err := intruder.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	_, _, err := intruder.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected policy violation close, got %v", err)
+	}
+}
+
+func TestWebSocketResumeGraceExpiryAnnouncesLeave(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(resumeGraceEnv, "100ms")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "grace-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "grace-room", "bob", "viewer")
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	_ = bob.Close()
+
+	left := readJSON(t, alice)
+	if left["type"] != "peer-left" {
+		t.Fatalf("expected peer-left after grace, got %v", left["type"])
+	}
+}
+
+func resumeToken(t *testing.T, welcome map[string]interface{}) string {
+	t.Helper()
+
+	payload, _ := welcome["payload"].(map[string]interface{})
+	token, _ := payload["resumeToken"].(string)
+	if welcome["type"] != "welcome" || token == "" {
+		t.Fatalf("expected welcome with resume token, got %v", welcome)
+	}
+	return token
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
+)
+
+const testTokenSecret = "test-secret"
+
+func TestWebSocketRequiresTokenWhenSecretConfigured(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(tokenSecretEnv, testTokenSecret)
+	h := NewHandler(HandlerConfig{Logger: newTestLogger()})
+
+	req := httptest.NewRequest(http.MethodGet, signalingPath+"?room=test&peer=alice", nil)
+	res := httptest.NewRecorder()
+
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, res.Code)
+	}
+}
+
+func TestWebSocketRejectsExpiredToken(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(tokenSecretEnv, testTokenSecret)
+	h := NewHandler(HandlerConfig{Logger: newTestLogger()})
+
+	token := issueTestToken(t, "test", "alice", signaling.RoleViewer, -time.Minute)
+	req := httptest.NewRequest(http.MethodGet, signalingPath+"?token="+url.QueryEscape(token), nil)
+	res := httptest.NewRecorder()
+
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, res.Code)
+	}
+}
+
+func TestWebSocketRejectsTokenForOtherRole(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(tokenSecretEnv, testTokenSecret)
+	h := NewHandler(HandlerConfig{Logger: newTestLogger()})
+
+	token := issueTestToken(t, "test", "alice", signaling.RoleViewer, time.Minute)
+	req := httptest.NewRequest(http.MethodGet, signalingPath+"?role=broadcaster&token="+url.QueryEscape(token), nil)
+	res := httptest.NewRecorder()
+
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, res.Code)
+	}
+}
+
+func TestWebSocketTokenBindsRoomPeerAndRole(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(tokenSecretEnv, testTokenSecret)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	token := issueTestToken(t, "token-room", "alice", signaling.RoleBroadcaster, time.Minute)
+	conn := dialWebSocketQuery(t, srv.URL, url.Values{"token": {token}})
+	defer closeConn(t, conn)
+
+	welcome := readJSON(t, conn)
+	if welcome["type"] != "welcome" {
+		t.Fatalf("expected welcome, got %v", welcome["type"])
+	}
+
+	payload, _ := welcome["payload"].(map[string]interface{})
+	if payload["peer"] != "alice" || payload["role"] != "broadcaster" {
+		t.Fatalf("expected broadcaster alice, got %v", payload)
+	}
+}
+
+func TestWebSocketNormalizesTokenRole(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(tokenSecretEnv, testTokenSecret)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	for peer, claim := range map[string]signaling.Role{"alice": "Broadcaster", "bob": " broadcaster "} {
+		token := issueTestToken(t, "case-room-"+peer, peer, claim, time.Minute)
+		conn := dialWebSocketQuery(t, srv.URL, url.Values{"role": {"broadcaster"}, "token": {token}})
+
+		welcome := readJSON(t, conn)
+		payload, _ := welcome["payload"].(map[string]interface{})
+		if welcome["type"] != "welcome" || payload["role"] != "broadcaster" {
+			t.Fatalf("expected broadcaster welcome for role claim %q, got %v", claim, welcome)
+		}
+		closeConn(t, conn)
+	}
+}
+
+func TestWebSocketClosesWhenTokenExpires(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(tokenSecretEnv, testTokenSecret)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	token := issueTestToken(t, "expiry-room", "alice", signaling.RoleViewer, 2*time.Second)
+	conn := dialWebSocketQuery(t, srv.URL, url.Values{"token": {token}})
+	defer closeConn(t, conn)
+
+	if welcome := readJSON(t, conn); welcome["type"] != "welcome" {
+		t.Fatalf("expected welcome, got %v", welcome["type"])
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(4 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, signaling.CloseTokenExpired) {
+		t.Fatalf("expected token expired close, got %v", err)
+	}
+}
+
+func issueTestToken(t *testing.T, room, peer string, role signaling.Role, ttl time.Duration) string {
+	t.Helper()
+
+	token, err := signaling.IssueToken([]byte(testTokenSecret), signaling.TokenClaims{
+		Room:      room,
+		Peer:      peer,
+		Role:      role,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	return token
+}
@@ -3,14 +3,21 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/signaling"
 )
 
 func TestWebSocketRequiresQueryParams(t *testing.T) {
@@ -46,13 +53,13 @@ func TestWebSocketSignalRouting(t *testing.T) {
 	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
 	t.Cleanup(srv.Close)
 
-	alice := dialWebSocket(t, srv.URL, "room1", "alice")
+	alice := dialWebSocket(t, srv.URL, "room1", "alice", "broadcaster")
 	defer closeConn(t, alice)
 
-	bob := dialWebSocket(t, srv.URL, "room1", "bob")
+	bob := dialWebSocket(t, srv.URL, "room1", "bob", "viewer")
 	defer closeConn(t, bob)
 
-	payload := map[string]string{"sdp": "dummy-offer"}
+	payload := offerPayload("dummy-offer")
 	msg := map[string]interface{}{
 		"type":    "offer",
 		"to":      "bob",
@@ -92,17 +99,98 @@ func TestWebSocketSignalRouting(t *testing.T) {
 	}
 }
 
+func TestWebSocketStampsSequenceAndTimestamp(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "seq-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "seq-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	before := time.Now().UnixMilli()
+	writeJSON(t, alice, map[string]interface{}{"type": "status", "seq": 100, "ts": 1})
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload("dummy-offer")})
+
+	var last float64
+	for i, want := range []string{"status", "offer"} {
+		msg := readJSON(t, bob)
+		if msg["type"] != want {
+			t.Fatalf("expected %s, got %v", want, msg)
+		}
+		seq, _ := msg["seq"].(float64)
+		if seq != last+1 {
+			t.Fatalf("expected seq %v for message %d, got %v", last+1, i, msg["seq"])
+		}
+		last = seq
+		if ts, _ := msg["ts"].(float64); int64(ts) < before || int64(ts) > time.Now().UnixMilli() {
+			t.Fatalf("expected a server receive timestamp, got %v", msg["ts"])
+		}
+	}
+}
+
+func TestWebSocketBroadcastSharesOneFrame(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "fanout-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	viewers := make([]*websocket.Conn, 3)
+	for i := range viewers {
+		viewers[i] = dialWebSocket(t, srv.URL, "fanout-room", fmt.Sprintf("viewer-%d", i), "viewer")
+		defer closeConn(t, viewers[i])
+		if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+			t.Fatalf("expected peer-joined, got %v", joined)
+		}
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"type": "chat", "payload": map[string]interface{}{"text": "hello", "tags": []string{"a"}}})
+
+	var first []byte
+	for _, viewer := range viewers {
+		if err := viewer.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("failed to set read deadline: %v", err)
+		}
+		_, data, err := viewer.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read broadcast: %v", err)
+		}
+		if first == nil {
+			first = data
+		} else if string(data) != string(first) {
+			t.Fatalf("expected every viewer to receive the same frame, got %s and %s", first, data)
+		}
+	}
+
+	var received map[string]interface{}
+	if err := json.Unmarshal(first, &received); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if received["type"] != "chat" || received["from"] != "alice" || received["seq"] != float64(1) {
+		t.Fatalf("unexpected broadcast %s", first)
+	}
+	if payload, _ := received["payload"].(map[string]interface{}); payload["text"] != "hello" {
+		t.Fatalf("expected the payload to be forwarded, got %v", received["payload"])
+	}
+}
+
 func TestWebSocketUnknownTargetSendsError(t *testing.T) {
 	t.Setenv(allowedOriginsEnv, "")
 	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
 	t.Cleanup(srv.Close)
 
-	alice := dialWebSocket(t, srv.URL, "room1", "alice")
+	alice := dialWebSocket(t, srv.URL, "room1", "alice", "broadcaster")
 	defer closeConn(t, alice)
 
 	msg := map[string]interface{}{
-		"type": "offer",
-		"to":   "carol",
+		"id":      "offer-1",
+		"type":    "offer",
+		"to":      "carol",
+		"payload": offerPayload("dummy-offer"),
 	}
 
 	writeJSON(t, alice, msg)
@@ -128,6 +216,455 @@ func TestWebSocketUnknownTargetSendsError(t *testing.T) {
 	if received["type"] != "error" {
 		t.Fatalf("expected error message, got type %v", received["type"])
 	}
+	if received["code"] != "target_not_found" || received["ref"] != "offer-1" || received["message"] != "target peer not found" {
+		t.Fatalf("unexpected error payload: %v", received)
+	}
+	details, _ := received["details"].(map[string]interface{})
+	if details["type"] != "offer" || details["to"] != "carol" {
+		t.Fatalf("unexpected error details: %v", received["details"])
+	}
+}
+
+func TestWebSocketAcknowledgesTargetedMessages(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "ack-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "ack-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"id": "offer-1", "type": "offer", "to": "bob", "ack": true, "payload": offerPayload("dummy-offer")})
+
+	if received := readJSON(t, bob); received["type"] != "offer" {
+		t.Fatalf("expected offer, got %v", received)
+	}
+
+	ack := readJSON(t, alice)
+	payload, _ := ack["payload"].(map[string]interface{})
+	if ack["type"] != "ack" || payload["id"] != "offer-1" || payload["to"] != "bob" || payload["status"] != "delivered" {
+		t.Fatalf("expected delivered ack, got %v", ack)
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"id": "offer-2", "type": "offer", "to": "carol", "ack": true, "payload": offerPayload("dummy-offer")})
+
+	ack = readJSON(t, alice)
+	payload, _ = ack["payload"].(map[string]interface{})
+	if ack["type"] != "ack" || payload["id"] != "offer-2" || payload["status"] != "target-gone" {
+		t.Fatalf("expected target-gone ack, got %v", ack)
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "ack": true, "payload": offerPayload("dummy-offer")})
+
+	if received := readJSON(t, alice); received["type"] != "error" || received["code"] != "invalid_message" {
+		t.Fatalf("expected invalid_message error for ack without id, got %v", received)
+	}
+}
+
+func TestWebSocketMailboxDeliversOnJoin(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(mailboxTTLEnv, "5s")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "mailbox-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	for i := 1; i <= 2; i++ {
+		writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload(fmt.Sprintf("seq-%d", i))})
+	}
+
+	bob := dialWebSocket(t, srv.URL, "mailbox-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	for i := 1; i <= 2; i++ {
+		received := readJSON(t, bob)
+		payload, _ := received["payload"].(map[string]interface{})
+		if received["type"] != "offer" || received["from"] != "alice" || payload["sdp"] != fmt.Sprintf("seq-%d", i) {
+			t.Fatalf("expected held offer %d, got %v", i, received)
+		}
+	}
+}
+
+func TestWebSocketMailboxExpiresWithError(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(mailboxTTLEnv, "100ms")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "mailbox-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	writeJSON(t, alice, map[string]interface{}{"id": "offer-1", "type": "offer", "to": "carol", "payload": offerPayload("dummy-offer")})
+
+	received := readJSON(t, alice)
+	if received["type"] != "error" || received["code"] != "mailbox_expired" || received["ref"] != "offer-1" {
+		t.Fatalf("expected mailbox_expired error, got %v", received)
+	}
+}
+
+func TestWebSocketReplaysRetainedMessagesToLateJoiners(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "retain-room", "alice", "broadcaster")
+
+	writeJSON(t, alice, map[string]interface{}{"type": "broadcaster-ready", "retain": true, "payload": map[string]int{"v": 1}})
+	writeJSON(t, alice, map[string]interface{}{"type": "broadcaster-ready", "retain": true, "payload": map[string]int{"v": 2}})
+	// frames are handled in order, so this error proves both were retained
+	writeJSON(t, alice, map[string]interface{}{"type": "sync", "to": "nobody"})
+	if received := readJSON(t, alice); received["type"] != "error" {
+		t.Fatalf("expected error, got %v", received)
+	}
+
+	bob := dialWebSocket(t, srv.URL, "retain-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	received := readJSON(t, bob)
+	payload, _ := received["payload"].(map[string]interface{})
+	if received["type"] != "broadcaster-ready" || received["from"] != "alice" || payload["v"] != float64(2) {
+		t.Fatalf("expected latest retained broadcaster-ready, got %v", received)
+	}
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+	closeConn(t, alice)
+
+	for _, expected := range []string{"peer-left", "broadcaster-left"} {
+		if msg := readJSON(t, bob); msg["type"] != expected {
+			t.Fatalf("expected %s, got %v", expected, msg["type"])
+		}
+	}
+
+	carol := dialWebSocket(t, srv.URL, "retain-room", "carol", "viewer")
+	defer closeConn(t, carol)
+
+	_ = carol.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := carol.ReadMessage(); err == nil {
+		t.Fatalf("expected retained message to be cleared after sender left, got %s", data)
+	}
+}
+
+func TestWebSocketRoutesToMultipleRecipients(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "multi-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	viewers := make(map[string]*websocket.Conn)
+	for _, id := range []string{"bob", "carol"} {
+		viewers[id] = dialWebSocket(t, srv.URL, "multi-room", id, "viewer")
+		defer closeConn(t, viewers[id])
+		if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+			t.Fatalf("expected peer-joined, got %v", joined["type"])
+		}
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"type": "stream-config", "to": "role:viewer"})
+	for id, conn := range viewers {
+		if received := readJSON(t, conn); received["type"] != "stream-config" {
+			t.Fatalf("expected %s to receive stream-config, got %v", id, received)
+		}
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"type": "except", "to": []string{"!bob"}})
+	writeJSON(t, alice, map[string]interface{}{"id": "list-1", "type": "list", "to": []string{"bob", "dave"}})
+
+	if received := readJSON(t, viewers["carol"]); received["type"] != "except" {
+		t.Fatalf("expected carol to receive except, got %v", received)
+	}
+	if received := readJSON(t, viewers["bob"]); received["type"] != "list" {
+		t.Fatalf("expected bob to skip except and receive list, got %v", received)
+	}
+
+	received := readJSON(t, alice)
+	details, _ := received["details"].(map[string]interface{})
+	missing, _ := details["missing"].([]interface{})
+	if received["code"] != "recipients_missing" || received["ref"] != "list-1" || len(missing) != 1 || missing[0] != "dave" {
+		t.Fatalf("expected recipients_missing for dave, got %v", received)
+	}
+}
+
+func TestWebSocketRejectsMalformedSignalingPayload(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "schema-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "schema-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"id": "ice-1", "type": "ice", "to": "bob", "payload": map[string]string{"sdpMid": "0"}})
+
+	received := readJSON(t, alice)
+	if received["code"] != "invalid_payload" || received["ref"] != "ice-1" || received["message"] != "invalid ice payload: candidate is required" {
+		t.Fatalf("expected invalid_payload error, got %v", received)
+	}
+
+	if err := bob.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, data, err := bob.ReadMessage(); err == nil {
+		t.Fatalf("expected malformed ice to be withheld from bob, got %s", data)
+	}
+}
+
+func TestWebSocketEnforcesRoomSDPPolicy(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"rooms": {"policy-room": {"sdp": {"videoBitrateKbps": 2500, "allowedMedia": ["audio", "video"], "onViolation": "reject"}}}}`
+	if err := os.WriteFile(policyFile, []byte(policy), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	t.Setenv(policyFileEnv, policyFile)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "policy-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "policy-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	video := "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\nc=IN IP4 0.0.0.0\r\na=rtpmap:96 H264/90000\r\n"
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload(video)})
+
+	received := readJSON(t, bob)
+	payload, _ := received["payload"].(map[string]interface{})
+	sdp, _ := payload["sdp"].(string)
+	if received["type"] != "offer" || !strings.Contains(sdp, "b=AS:2500\r\nb=TIAS:2500000\r\n") {
+		t.Fatalf("expected bandwidth-capped offer, got %v", received)
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"id": "offer-2", "type": "offer", "to": "bob", "payload": offerPayload("v=0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n")})
+
+	rejected := readJSON(t, alice)
+	if rejected["code"] != "policy_violation" || rejected["ref"] != "offer-2" {
+		t.Fatalf("expected policy_violation error, got %v", rejected)
+	}
+}
+
+func TestWebSocketFiltersICECandidatesByRoomPolicy(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte(`{"default": {"ice": {"relayOnly": true}}}`), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	t.Setenv(policyFileEnv, policyFile)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "relay-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "relay-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	host := "candidate:1 1 udp 2122260223 192.168.1.10 54321 typ host"
+	relay := "candidate:2 1 udp 41885439 198.51.100.9 3478 typ relay raddr 203.0.113.7 rport 61000"
+	for _, candidate := range []string{host, relay} {
+		writeJSON(t, alice, map[string]interface{}{
+			"type":    "ice",
+			"to":      "bob",
+			"payload": map[string]interface{}{"candidate": candidate, "sdpMid": "0", "sdpMLineIndex": 0},
+		})
+	}
+
+	received := readJSON(t, bob)
+	payload, _ := received["payload"].(map[string]interface{})
+	if received["type"] != "ice" || payload["candidate"] != relay {
+		t.Fatalf("expected only the relay candidate, got %v", received)
+	}
+}
+
+func TestWebSocketAcknowledgesFilteredICECandidate(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte(`{"default": {"ice": {"relayOnly": true}}}`), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	t.Setenv(policyFileEnv, policyFile)
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "relay-ack-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "relay-ack-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	writeJSON(t, alice, map[string]interface{}{
+		"id":      "ice-1",
+		"type":    "ice",
+		"to":      "bob",
+		"ack":     true,
+		"payload": map[string]interface{}{"candidate": "candidate:1 1 udp 2122260223 192.168.1.10 54321 typ host", "sdpMid": "0"},
+	})
+
+	ack := readJSON(t, alice)
+	payload, _ := ack["payload"].(map[string]interface{})
+	if ack["type"] != "ack" || payload["id"] != "ice-1" || payload["to"] != "bob" || payload["status"] != "filtered" {
+		t.Fatalf("expected filtered ack, got %v", ack)
+	}
+
+	// selectors are acknowledged per resolved peer
+	writeJSON(t, alice, map[string]interface{}{
+		"id":      "ice-2",
+		"type":    "ice",
+		"to":      []string{"role:viewer"},
+		"ack":     true,
+		"payload": map[string]interface{}{"candidate": "candidate:1 1 udp 2122260223 192.168.1.10 54321 typ host", "sdpMid": "0"},
+	})
+
+	ack = readJSON(t, alice)
+	payload, _ = ack["payload"].(map[string]interface{})
+	if ack["type"] != "ack" || payload["id"] != "ice-2" || payload["to"] != "bob" || payload["status"] != "filtered" {
+		t.Fatalf("expected filtered ack for bob, got %v", ack)
+	}
+}
+
+func TestWebSocketReportsICEDiagnostics(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(diagnosticsEnv, "true")
+	srv, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, srv.URL, "diag-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "diag-room", "bob", "viewer")
+	defer closeConn(t, bob)
+	if msg := readJSON(t, alice); msg["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", msg)
+	}
+
+	offer := "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=candidate:1 1 udp 2122260223 192.168.1.10 54321 typ host\r\n"
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload(offer)})
+	if msg := readJSON(t, bob); msg["type"] != "offer" {
+		t.Fatalf("expected offer, got %v", msg)
+	}
+
+	writeJSON(t, bob, map[string]interface{}{
+		"type":    "ice",
+		"to":      "alice",
+		"payload": map[string]interface{}{"candidate": "candidate:2 1 udp 2122260223 fd00::2 50000 typ host", "sdpMid": "0"},
+	})
+	if msg := readJSON(t, alice); msg["type"] != "ice" {
+		t.Fatalf("expected ice, got %v", msg)
+	}
+
+	public, err := http.Get(srv.URL + "/diagnostics/rooms/diag-room/ice")
+	if err != nil {
+		t.Fatalf("diagnostics request failed: %v", err)
+	}
+	public.Body.Close()
+	if public.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected diagnostics to be absent from the public listener, got status %d", public.StatusCode)
+	}
+
+	resp := adminRequest(t, admin, http.MethodGet, "/diagnostics/rooms/diag-room/ice", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var report signaling.ICEReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if len(report.Pairs) != 1 {
+		t.Fatalf("expected one pair, got %+v", report.Pairs)
+	}
+	pair := report.Pairs[0]
+	if pair.Peers != [2]string{"alice", "bob"} || !pair.OfferSeen || pair.AnswerSeen {
+		t.Fatalf("unexpected pair %+v", pair)
+	}
+	if got := pair.Candidates["alice"]; got.Types["host"] != 1 || got.Families["ipv4"] != 1 {
+		t.Fatalf("unexpected candidates from alice %+v", got)
+	}
+	if got := pair.Candidates["bob"]; got.Types["host"] != 1 || got.Families["ipv6"] != 1 {
+		t.Fatalf("unexpected candidates from bob %+v", got)
+	}
+
+	warnings := strings.Join(pair.Warnings, "; ")
+	for _, want := range []string{"offer was never answered", "both sides only had host candidates", "no common address family"} {
+		if !strings.Contains(warnings, want) {
+			t.Fatalf("expected warning %q, got %q", want, warnings)
+		}
+	}
+
+	missing := adminRequest(t, admin, http.MethodGet, "/diagnostics/rooms/unknown-room/ice", nil)
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d for unknown room, got %d", http.StatusNotFound, missing.StatusCode)
+	}
+}
+
+func TestWebSocketReportsHandshakeTimings(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(diagnosticsEnv, "true")
+	srv, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, srv.URL, "timing-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "timing-room", "bob", "viewer")
+	defer closeConn(t, bob)
+	if msg := readJSON(t, alice); msg["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", msg)
+	}
+
+	endOfCandidates := map[string]interface{}{"candidate": "", "sdpMid": "0"}
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload("v=0")})
+	writeJSON(t, alice, map[string]interface{}{"type": "ice", "to": "bob", "payload": endOfCandidates})
+	for _, want := range []string{"offer", "ice"} {
+		if msg := readJSON(t, bob); msg["type"] != want {
+			t.Fatalf("expected %s, got %v", want, msg)
+		}
+	}
+
+	writeJSON(t, bob, map[string]interface{}{"type": "answer", "to": "alice", "payload": map[string]string{"type": "answer", "sdp": "v=0"}})
+	writeJSON(t, bob, map[string]interface{}{"type": "ice", "to": "alice", "payload": endOfCandidates})
+	for _, want := range []string{"answer", "ice"} {
+		if msg := readJSON(t, alice); msg["type"] != want {
+			t.Fatalf("expected %s, got %v", want, msg)
+		}
+	}
+
+	for _, path := range []string{"/diagnostics/rooms/timing-room/handshakes", "/diagnostics/handshakes"} {
+		resp := adminRequest(t, admin, http.MethodGet, path, nil)
+		var report signaling.HandshakeReport
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("failed to decode report from %s: %v", path, err)
+		}
+
+		for _, phase := range []string{signaling.PhaseJoinToOffer, signaling.PhaseOfferToAnswer, signaling.PhaseAnswerToLastCandidate} {
+			if got := report.Phases[phase].Count; got != 1 {
+				t.Fatalf("expected one %s sample from %s, got %+v", phase, path, report.Phases)
+			}
+		}
+	}
 }
 
 func TestWebSocketDispatchDuringDisconnectDoesNotPanic(t *testing.T) {
@@ -135,10 +672,10 @@ func TestWebSocketDispatchDuringDisconnectDoesNotPanic(t *testing.T) {
 	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
 	t.Cleanup(srv.Close)
 
-	alice := dialWebSocket(t, srv.URL, "race-room", "alice")
+	alice := dialWebSocket(t, srv.URL, "race-room", "alice", "broadcaster")
 	t.Cleanup(func() { closeConn(t, alice) })
 
-	bob := dialWebSocket(t, srv.URL, "race-room", "bob")
+	bob := dialWebSocket(t, srv.URL, "race-room", "bob", "viewer")
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -148,7 +685,7 @@ func TestWebSocketDispatchDuringDisconnectDoesNotPanic(t *testing.T) {
 			msg := map[string]interface{}{
 				"type":    "offer",
 				"to":      "bob",
-				"payload": map[string]int{"seq": i},
+				"payload": offerPayload(fmt.Sprintf("seq-%d", i)),
 			}
 			writeJSON(t, alice, msg)
 		}
@@ -164,6 +701,367 @@ func TestWebSocketDispatchDuringDisconnectDoesNotPanic(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 }
 
+func TestWebSocketWelcomeIncludesRoster(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "roster-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocketQuery(t, srv.URL, url.Values{"room": {"roster-room"}, "peer": {"bob"}, "role": {"viewer"}})
+	defer closeConn(t, bob)
+
+	welcome := readJSON(t, bob)
+	if welcome["type"] != "welcome" {
+		t.Fatalf("expected welcome, got type %v", welcome["type"])
+	}
+	if welcome["from"] != "server" {
+		t.Fatalf("expected from server, got %v", welcome["from"])
+	}
+
+	payload, ok := welcome["payload"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected welcome payload, got %v", welcome["payload"])
+	}
+	if payload["peer"] != "bob" {
+		t.Fatalf("expected peer bob, got %v", payload["peer"])
+	}
+
+	peers, ok := payload["peers"].([]interface{})
+	if !ok || len(peers) != 1 {
+		t.Fatalf("expected one peer in roster, got %v", payload["peers"])
+	}
+	if entry, _ := peers[0].(map[string]interface{}); entry["id"] != "alice" || entry["role"] != "broadcaster" {
+		t.Fatalf("expected broadcaster alice in roster, got %v", peers[0])
+	}
+}
+
+func TestWebSocketPresenceEvents(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "presence-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	bob := dialWebSocket(t, srv.URL, "presence-room", "bob", "viewer")
+
+	joined := readJSON(t, alice)
+	if joined["type"] != "peer-joined" || joined["from"] != "server" {
+		t.Fatalf("expected peer-joined from server, got %v", joined)
+	}
+	if payload, _ := joined["payload"].(map[string]interface{}); payload["peer"] != "bob" {
+		t.Fatalf("expected peer-joined for bob, got %v", joined["payload"])
+	}
+
+	closeConn(t, bob)
+
+	left := readJSON(t, alice)
+	if left["type"] != "peer-left" || left["from"] != "server" {
+		t.Fatalf("expected peer-left from server, got %v", left)
+	}
+	if payload, _ := left["payload"].(map[string]interface{}); payload["peer"] != "bob" {
+		t.Fatalf("expected peer-left for bob, got %v", left["payload"])
+	}
+}
+
+func TestWebSocketBroadcasterLeftNotifiesViewers(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	bob := dialWebSocket(t, srv.URL, "left-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	alice := dialWebSocket(t, srv.URL, "left-room", "alice", "broadcaster")
+
+	if joined := readJSON(t, bob); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	closeConn(t, alice)
+
+	if left := readJSON(t, bob); left["type"] != "peer-left" {
+		t.Fatalf("expected peer-left, got %v", left["type"])
+	}
+	if left := readJSON(t, bob); left["type"] != "broadcaster-left" || left["from"] != "server" {
+		t.Fatalf("expected broadcaster-left from server, got %v", left)
+	}
+}
+
+func TestWebSocketRejectsSecondBroadcaster(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "solo-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	carol := dialWebSocketQuery(t, srv.URL, url.Values{"room": {"solo-room"}, "peer": {"carol"}, "role": {"broadcaster"}})
+	defer closeConn(t, carol)
+
+	if err := carol.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	_, _, err := carol.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected policy violation close, got %v", err)
+	}
+}
+
+func TestWebSocketViewersCannotMessageEachOther(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	bob := dialWebSocket(t, srv.URL, "viewers-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	carol := dialWebSocket(t, srv.URL, "viewers-room", "carol", "viewer")
+	defer closeConn(t, carol)
+
+	writeJSON(t, bob, map[string]interface{}{"type": "offer", "to": "carol", "payload": offerPayload("dummy-offer")})
+
+	received := readJSON(t, bob)
+	if received["type"] != "error" || received["message"] != "target peer not allowed" {
+		t.Fatalf("expected target not allowed error, got %v", received)
+	}
+
+	writeJSON(t, bob, map[string]interface{}{"type": "chat"})
+
+	if err := carol.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, data, err := carol.ReadMessage(); err == nil {
+		t.Fatalf("expected no message for carol, got %s", data)
+	}
+}
+
+func TestWebSocketRateLimitRejectsAndDisconnects(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(rateLimitEnv, "0.1:2")
+	t.Setenv(rateLimitMaxViolationsEnv, "2")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "flood-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	for i := 0; i < 3; i++ {
+		writeJSON(t, alice, map[string]interface{}{"type": "status"})
+	}
+
+	received := readJSON(t, alice)
+	if received["type"] != "error" || received["message"] != "rate limit exceeded" {
+		t.Fatalf("expected rate limit error, got %v", received)
+	}
+
+	writeJSON(t, alice, map[string]interface{}{"type": "status"})
+
+	if err := alice.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	_, _, err := alice.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected policy violation close, got %v", err)
+	}
+}
+
+func TestWebSocketSlowConsumerNotifiesSender(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(sendQueueSizeEnv, "1")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "slow-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	// bob never reads, so his socket buffers and then his queue fill up
+	bob := dialWebSocket(t, srv.URL, "slow-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	blob := strings.Repeat("x", 512<<10)
+	for i := 0; i < 24; i++ {
+		writeJSON(t, alice, map[string]interface{}{"type": "chat", "to": "bob", "payload": blob})
+	}
+
+	received := readJSON(t, alice)
+	if received["type"] != "error" || received["message"] != `delivery to peer "bob" failed` {
+		t.Fatalf("expected delivery failure error, got %v", received)
+	}
+}
+
+func TestWebSocketEvictsUnresponsivePeer(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(pingIntervalEnv, "50ms")
+	t.Setenv(pongTimeoutEnv, "50ms")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "keepalive-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	// alice reads from now on, which answers pings even while bob connects,
+	// and observes bob's eviction
+	frames := make(chan map[string]interface{}, 4)
+	go func() {
+		defer close(frames)
+		for {
+			var msg map[string]interface{}
+			if err := alice.ReadJSON(&msg); err != nil {
+				return
+			}
+			frames <- msg
+		}
+	}()
+	next := func() map[string]interface{} {
+		t.Helper()
+		select {
+		case msg, ok := <-frames:
+			if !ok {
+				t.Fatal("alice was disconnected")
+			}
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a frame to alice")
+			return nil
+		}
+	}
+
+	// bob stops reading after the welcome, so pings are never answered
+	bob := dialWebSocket(t, srv.URL, "keepalive-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := next(); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+	left := next()
+	if left["type"] != "peer-left" {
+		t.Fatalf("expected peer-left, got %v", left["type"])
+	}
+	if payload, _ := left["payload"].(map[string]interface{}); payload["peer"] != "bob" {
+		t.Fatalf("expected bob to be evicted, got %v", left["payload"])
+	}
+}
+
+func TestWebSocketDuplicateBroadcasterReplacesStaleConnection(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(duplicatePeerPolicyEnv, "broadcaster=replace")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	stale := dialWebSocket(t, srv.URL, "replace-room", "alice", "broadcaster")
+	defer closeConn(t, stale)
+
+	bob := dialWebSocket(t, srv.URL, "replace-room", "bob", "viewer")
+	defer closeConn(t, bob)
+
+	if joined := readJSON(t, stale); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	fresh := dialWebSocket(t, srv.URL, "replace-room", "alice", "broadcaster")
+	defer closeConn(t, fresh)
+
+	if err := stale.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, _, err := stale.ReadMessage(); !websocket.IsCloseError(err, signaling.CloseReplaced) {
+		t.Fatalf("expected replaced close, got %v", err)
+	}
+
+	for _, want := range []string{"peer-left", "broadcaster-left", "peer-joined"} {
+		if msg := readJSON(t, bob); msg["type"] != want {
+			t.Fatalf("expected %s, got %v", want, msg["type"])
+		}
+	}
+}
+
+func TestWebSocketDuplicateViewerGetsSuffix(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(duplicatePeerPolicyEnv, "viewer=suffix")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	first := dialWebSocket(t, srv.URL, "suffix-room", "bob", "viewer")
+	defer closeConn(t, first)
+
+	second := dialWebSocketQuery(t, srv.URL, url.Values{"room": {"suffix-room"}, "peer": {"bob"}, "role": {"viewer"}})
+	defer closeConn(t, second)
+
+	welcome := readJSON(t, second)
+	payload, _ := welcome["payload"].(map[string]interface{})
+	peer, _ := payload["peer"].(string)
+	if welcome["type"] != "welcome" || !strings.HasPrefix(peer, "bob-") {
+		t.Fatalf("expected welcome with suffixed peer id, got %v", welcome)
+	}
+}
+
+func TestWebSocketAssignsPeerIDWhenMissing(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	t.Setenv(assignPeerIDsEnv, "true")
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
+	t.Cleanup(srv.Close)
+
+	alice := dialWebSocket(t, srv.URL, "assign-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+
+	viewer := dialWebSocketQuery(t, srv.URL, url.Values{"room": {"assign-room"}, "role": {"viewer"}})
+	defer closeConn(t, viewer)
+
+	welcome := readJSON(t, viewer)
+	payload, _ := welcome["payload"].(map[string]interface{})
+	assigned, _ := payload["peer"].(string)
+	if welcome["type"] != "welcome" || !strings.HasPrefix(assigned, "viewer-") {
+		t.Fatalf("expected welcome with assigned viewer id, got %v", welcome)
+	}
+
+	if joined := readJSON(t, alice); joined["type"] != "peer-joined" {
+		t.Fatalf("expected peer-joined, got %v", joined["type"])
+	}
+
+	writeJSON(t, viewer, map[string]interface{}{"type": "viewer-ready", "to": "alice"})
+
+	received := readJSON(t, alice)
+	if received["type"] != "viewer-ready" || received["from"] != assigned {
+		t.Fatalf("expected viewer-ready from %s, got %v", assigned, received)
+	}
+}
+
+func TestWebSocketRejectsInvalidRole(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	h := NewHandler(HandlerConfig{Logger: newTestLogger()})
+
+	req := httptest.NewRequest(http.MethodGet, signalingPath+"?room=test&peer=alice&role=admin", nil)
+	res := httptest.NewRecorder()
+
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestWebSocketRejectsReservedPeerID(t *testing.T) {
+	t.Setenv(allowedOriginsEnv, "")
+	h := NewHandler(HandlerConfig{Logger: newTestLogger()})
+
+	req := httptest.NewRequest(http.MethodGet, signalingPath+"?room=test&peer=server", nil)
+	res := httptest.NewRecorder()
+
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
 func TestWebSocketRejectsDisallowedOrigin(t *testing.T) {
 	t.Setenv(allowedOriginsEnv, "https://allowed.example")
 	srv := httptest.NewServer(NewHandler(HandlerConfig{Logger: newTestLogger()}))
@@ -191,7 +1089,110 @@ func TestWebSocketRejectsDisallowedOrigin(t *testing.T) {
 	}
 }
 
-func dialWebSocket(t *testing.T, baseURL, room, peer string) *websocket.Conn {
+func TestWebSocketActivityIsExportedAsMetrics(t *testing.T) {
+	srv, admin := newAdminTestServers(t)
+
+	alice := dialWebSocket(t, srv.URL, "metrics-room", "alice", "broadcaster")
+	defer closeConn(t, alice)
+	bob := dialWebSocket(t, srv.URL, "metrics-room", "bob", "viewer")
+
+	writeJSON(t, alice, map[string]interface{}{"type": "offer", "to": "bob", "payload": offerPayload("dummy-offer")})
+	if msg := readJSON(t, bob); msg["type"] != "offer" {
+		t.Fatalf("expected offer, got %v", msg["type"])
+	}
+	writeJSON(t, alice, map[string]interface{}{"type": "custom-note", "to": "bob", "payload": map[string]string{}})
+	if msg := readJSON(t, bob); msg["type"] != "custom-note" {
+		t.Fatalf("expected custom-note, got %v", msg["type"])
+	}
+
+	carol := dialWebSocketQuery(t, srv.URL, url.Values{"room": {"metrics-room"}, "peer": {"carol"}, "role": {"broadcaster"}})
+	defer closeConn(t, carol)
+	if err := carol.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, _, err := carol.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected policy violation close, got %v", err)
+	}
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server url: %v", err)
+	}
+	u.Scheme = "ws"
+	u.Path = signalingPath
+	u.RawQuery = url.Values{"room": {"metrics-room"}, "peer": {"mallory"}}.Encode()
+	if _, _, err := websocket.DefaultDialer.Dial(u.String(), http.Header{"Origin": {"https://not-allowed.example"}}); err == nil {
+		t.Fatalf("expected handshake error for disallowed origin")
+	}
+
+	closeConn(t, bob)
+
+	want := []string{
+		"rabbit_signaling_rooms 1",
+		`rabbit_signaling_peers{role="broadcaster"} 1`,
+		`rabbit_signaling_peers{role="viewer"} 0`,
+		"rabbit_signaling_joins_total 2",
+		"rabbit_signaling_leaves_total 1",
+		`rabbit_signaling_messages_routed_total{type="answer"} 0`,
+		`rabbit_signaling_messages_routed_total{type="offer"} 1`,
+		`rabbit_signaling_messages_routed_total{type="other"} 1`,
+		"rabbit_signaling_rejected_origins_total 1",
+		`rabbit_signaling_register_failures_total{reason="broadcaster_exists"} 1`,
+		"# TYPE rabbit_signaling_send_queue_depth histogram",
+		"# TYPE rabbit_signaling_write_duration_seconds histogram",
+	}
+	res, err := http.Get(srv.URL + metricsPath)
+	if err != nil {
+		t.Fatalf("metrics request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected metrics to be absent from the public listener, got %d", res.StatusCode)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		res := adminRequest(t, admin, http.MethodGet, metricsPath, nil)
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("failed to read metrics: %v", err)
+		}
+		if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+			t.Fatalf("unexpected content type %q", got)
+		}
+
+		var missing []string
+		for _, line := range want {
+			if !strings.Contains(string(body), line+"\n") {
+				missing = append(missing, line)
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics are missing %q:\n%s", missing, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func dialWebSocket(t *testing.T, baseURL, room, peer, role string) *websocket.Conn {
+	t.Helper()
+
+	conn := dialWebSocketQuery(t, baseURL, url.Values{"room": {room}, "peer": {peer}, "role": {role}})
+
+	welcome := readJSON(t, conn)
+	if welcome["type"] != "welcome" {
+		t.Fatalf("expected welcome message, got type %v", welcome["type"])
+	}
+
+	return conn
+}
+
+// dialWebSocketQuery connects with the given query parameters without
+// consuming the welcome message.
+func dialWebSocketQuery(t *testing.T, baseURL string, query url.Values) *websocket.Conn {
 	t.Helper()
 
 	u, err := url.Parse(baseURL)
@@ -201,11 +1202,7 @@ func dialWebSocket(t *testing.T, baseURL, room, peer string) *websocket.Conn {
 
 	u.Scheme = "ws"
 	u.Path = signalingPath
-
-	q := u.Query()
-	q.Set("room", room)
-	q.Set("peer", peer)
-	u.RawQuery = q.Encode()
+	u.RawQuery = query.Encode()
 
 	dialCtx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -220,6 +1217,30 @@ func dialWebSocket(t *testing.T, baseURL, room, peer string) *websocket.Conn {
 	return conn
 }
 
+func readJSON(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	msgType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+
+	if msgType != websocket.TextMessage {
+		t.Fatalf("expected text message, got %d", msgType)
+	}
+
+	var received map[string]interface{}
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	return received
+}
+
 func writeJSON(t *testing.T, conn *websocket.Conn, msg interface{}) {
 	t.Helper()
 
@@ -232,6 +1253,10 @@ func writeJSON(t *testing.T, conn *websocket.Conn, msg interface{}) {
 	}
 }
 
+func offerPayload(sdp string) map[string]string {
+	return map[string]string{"type": "offer", "sdp": sdp}
+}
+
 func mustJSON(t *testing.T, v interface{}) []byte {
 	t.Helper()
 
@@ -0,0 +1,54 @@
+package signaling
+
+// AckStatus reports what happened to a targeted message sent with ack set.
+type AckStatus string
+
+const (
+	// AckDelivered means the frame was written to the target's socket.
+	AckDelivered AckStatus = "delivered"
+	// AckDropped means the frame was discarded because a queue was full.
+	AckDropped AckStatus = "dropped"
+	// AckTargetGone means the target left before the frame could be written.
+	AckTargetGone AckStatus = "target-gone"
+	// AckFiltered means the room's media policy discarded the message.
+	AckFiltered AckStatus = "filtered"
+)
+
+// AckPayload is sent back to the sender of a message that requested an ack.
+type AckPayload struct {
+	ID     string    `json:"id"`
+	To     string    `json:"to"`
+	Status AckStatus `json:"status"`
+}
+
+// acknowledge reports the fate of item to its sender if an ack was requested.
+func acknowledge(item outbound, to string, status AckStatus) {
+	if !item.ack || item.from == nil {
+		return
+	}
+	item.from.enqueue(outbound{
+		data:    newSystemMessage(typeAck, AckPayload{ID: item.id, To: to, Status: status}),
+		msgType: typeAck,
+	})
+}
+
+// abandon reports target-gone for the acked frames among items that will
+// never reach peerID.
+func abandon(items []outbound, peerID string) {
+	for _, item := range items {
+		acknowledge(item, peerID, AckTargetGone)
+	}
+}
+
+// reportDropped tells the sender of a discarded frame, with an ack when one
+// was requested and with an error otherwise.
+func reportDropped(item outbound, peerID string) {
+	if item.from == nil {
+		return
+	}
+	if item.ack {
+		acknowledge(item, peerID, AckDropped)
+		return
+	}
+	item.from.sendError(deliveryFailedError(peerID, item))
+}
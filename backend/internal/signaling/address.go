@@ -0,0 +1,153 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Recipient selectors accepted in Message.To besides plain peer IDs.
+const (
+	// rolePrefix selects every reachable peer of a role, e.g. "role:viewer".
+	rolePrefix = "role:"
+	// exceptPrefix excludes a peer, e.g. "!bob". A list made only of
+	// exclusions addresses everyone reachable except those peers.
+	exceptPrefix = "!"
+)
+
+var errInvalidRecipient = errors.New("invalid recipient")
+
+// Recipients is the to field of a message. It is encoded as a single string
+// when it names one peer and as an array of selectors otherwise. An empty
+// value addresses every reachable peer.
+type Recipients []string
+
+// UnmarshalJSON accepts either a string or an array of strings.
+func (r *Recipients) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single == "" {
+			*r = nil
+		} else {
+			*r = Recipients{single}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*r = list
+	return nil
+}
+
+// MarshalJSON encodes a single recipient as a plain string.
+func (r Recipients) MarshalJSON() ([]byte, error) {
+	if len(r) == 1 {
+		return json.Marshal(r[0])
+	}
+	return json.Marshal([]string(r))
+}
+
+// peer returns the peer ID when r names exactly one peer without selectors.
+func (r Recipients) peer() (string, bool) {
+	if len(r) != 1 || isSelector(r[0]) {
+		return "", false
+	}
+	return r[0], true
+}
+
+// validate rejects empty entries and unknown roles.
+func (r Recipients) validate() error {
+	for _, entry := range r {
+		switch {
+		case strings.HasPrefix(entry, rolePrefix):
+			if _, ok := parseRole(strings.TrimPrefix(entry, rolePrefix)); !ok || entry == rolePrefix {
+				return errInvalidRecipient
+			}
+		case strings.HasPrefix(entry, exceptPrefix):
+			if entry == exceptPrefix {
+				return errInvalidRecipient
+			}
+		case entry == "":
+			return errInvalidRecipient
+		}
+	}
+	return nil
+}
+
+// isSelector reports whether entry is a role selector or an exclusion rather
+// than a peer ID. Peer IDs of this shape are rejected at connect time.
+func isSelector(entry string) bool {
+	return strings.HasPrefix(entry, rolePrefix) || strings.HasPrefix(entry, exceptPrefix)
+}
+
+// resolve expands to into the clients and detached peers from may reach. Named
+// peers that are absent or unreachable are returned as missing; from the
+// sender's point of view the latter do not exist.
+func (r *room) resolve(fromID string, fromRole Role, to Recipients) (clients []*Client, detached []string, missing []string) {
+	excluded := map[string]struct{}{fromID: {}}
+	var roles []Role
+	var named []string
+	for _, entry := range to {
+		switch {
+		case strings.HasPrefix(entry, exceptPrefix):
+			excluded[strings.TrimPrefix(entry, exceptPrefix)] = struct{}{}
+		case strings.HasPrefix(entry, rolePrefix):
+			role, _ := parseRole(strings.TrimPrefix(entry, rolePrefix))
+			roles = append(roles, role)
+		default:
+			named = append(named, entry)
+		}
+	}
+	everyone := len(roles) == 0 && len(named) == 0
+
+	selected := func(id string, role Role) bool {
+		if _, skip := excluded[id]; skip || !canReach(fromRole, role) {
+			return false
+		}
+		if everyone {
+			return true
+		}
+		for _, wanted := range roles {
+			if role == wanted {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := make(map[string]struct{})
+	for id, client := range r.clients {
+		if selected(id, client.role) {
+			seen[id] = struct{}{}
+			clients = append(clients, client)
+		}
+	}
+	for id, d := range r.detached {
+		if selected(id, d.role) {
+			seen[id] = struct{}{}
+			detached = append(detached, id)
+		}
+	}
+
+	for _, id := range named {
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		if _, skip := excluded[id]; skip {
+			continue
+		}
+		seen[id] = struct{}{}
+		if client, ok := r.clients[id]; ok && canReach(fromRole, client.role) {
+			clients = append(clients, client)
+		} else if d, ok := r.detached[id]; ok && canReach(fromRole, d.role) {
+			detached = append(detached, id)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return clients, detached, missing
+}
@@ -0,0 +1,43 @@
+package signaling
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRecipientsAcceptsStringOrList(t *testing.T) {
+	cases := map[string]Recipients{
+		`{"to":"bob"}`:                 {"bob"},
+		`{"to":""}`:                    nil,
+		`{"to":["bob","role:viewer"]}`: {"bob", "role:viewer"},
+		`{"type":"offer"}`:             nil,
+	}
+	for raw, want := range cases {
+		var msg Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatalf("unmarshal %s: %v", raw, err)
+		}
+		if !reflect.DeepEqual(msg.To, want) {
+			t.Fatalf("unmarshal %s: expected %v, got %v", raw, want, msg.To)
+		}
+	}
+
+	data, _ := json.Marshal(Message{Type: "offer", To: Recipients{"bob"}})
+	if string(data) != `{"type":"offer","to":"bob"}` {
+		t.Fatalf("expected single recipient as string, got %s", data)
+	}
+}
+
+func TestRecipientsValidate(t *testing.T) {
+	for _, to := range []Recipients{{"bob"}, {"role:viewer"}, {"!bob", "!carol"}} {
+		if err := to.validate(); err != nil {
+			t.Fatalf("expected %v to be valid, got %v", to, err)
+		}
+	}
+	for _, to := range []Recipients{{""}, {"role:"}, {"role:admin"}, {"!"}} {
+		if err := to.validate(); err == nil {
+			t.Fatalf("expected %v to be rejected", to)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package signaling
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRejoinBlock is how long a peer removed by an operator cannot rejoin
+// its room when HubConfig.RejoinBlock is zero.
+const DefaultRejoinBlock = 30 * time.Second
+
+// Errors returned by the operator actions of a Hub.
+var (
+	ErrRoomNotFound       = errors.New("room not found")
+	ErrPeerNotFound       = errors.New("peer not found")
+	ErrNoBroadcaster      = errors.New("room has no broadcaster")
+	ErrInvalidCloseCode   = errors.New("invalid close code")
+	ErrCloseReasonTooLong = errors.New("close reason too long")
+)
+
+// RoomSummary is a point-in-time view of a room held by the hub.
+type RoomSummary struct {
+	Room string `json:"room"`
+	// Peers counts the connected peers, Detached the peers waiting to resume
+	// and RemotePeers the peers other nodes hold in the room.
+	Peers       int    `json:"peers"`
+	Detached    int    `json:"detached"`
+	RemotePeers int    `json:"remotePeers,omitempty"`
+	Broadcaster string `json:"broadcaster,omitempty"`
+}
+
+// Rooms returns a summary of every room held by the hub, ordered by room ID.
+func (h *Hub) Rooms() []RoomSummary {
+	out := []RoomSummary{}
+	for _, r := range h.roomList() {
+		var summary RoomSummary
+		if r.call(func() { summary = r.summary() }) {
+			out = append(out, summary)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Room < out[j].Room })
+	return out
+}
+
+func (r *room) summary() RoomSummary {
+	broadcaster := r.broadcaster
+	if broadcaster == "" {
+		broadcaster, _ = r.remoteBroadcaster()
+	}
+	return RoomSummary{
+		Room:        r.id,
+		Peers:       len(r.clients),
+		Detached:    len(r.detached),
+		RemotePeers: len(r.remote),
+		Broadcaster: broadcaster,
+	}
+}
+
+// RoomPeers returns statistics for the peers connected to roomID, ordered by
+// peer ID. It reports false when the hub holds no such room.
+func (h *Hub) RoomPeers(roomID string) ([]PeerStats, bool) {
+	r, ok := h.lookupRoom(roomID)
+	if !ok {
+		return nil, false
+	}
+
+	out := []PeerStats{}
+	if !r.call(func() {
+		for _, c := range r.clients {
+			out = append(out, c.stats())
+		}
+	}) {
+		return nil, false
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out, true
+}
+
+// Kick closes the connection of a peer with code and reason. A code of zero
+// sends CloseKicked. A peer waiting to resume loses its slot instead. Either
+// way the peer cannot rejoin the room for the rejoin block.
+func (h *Hub) Kick(roomID, peerID string, code int, reason string) error {
+	if code == 0 {
+		code = CloseKicked
+	}
+	if !validCloseCode(code) {
+		return ErrInvalidCloseCode
+	}
+	if len(reason) > maxCloseReasonBytes {
+		return ErrCloseReasonTooLong
+	}
+	if reason == "" {
+		reason = "kicked"
+	}
+
+	r, ok := h.lookupRoom(roomID)
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	var client *Client
+	var held *detachedPeer
+	if !r.call(func() {
+		client = r.clients[peerID]
+		held = r.detached[peerID]
+	}) {
+		return ErrRoomNotFound
+	}
+
+	switch {
+	case client != nil:
+		h.blockRejoin(roomID, peerID)
+		h.logger.Info("kicking peer", "room", roomID, "peer", peerID, "close_code", code, "reason", reason)
+		client.closeWithCode(code, reason)
+	case held != nil:
+		h.blockRejoin(roomID, peerID)
+		h.logger.Info("kicking detached peer", "room", roomID, "peer", peerID, "reason", reason)
+		h.evictDetached(r, held)
+	default:
+		return ErrPeerNotFound
+	}
+	return nil
+}
+
+// CloseRoom sends room-closed with message to every member of roomID and then
+// closes their connections with CloseRoomClosed. Peers waiting to resume lose
+// their slots. None of them can rejoin the room for the rejoin block; other
+// peers still can.
+func (h *Hub) CloseRoom(roomID, message string) error {
+	r, ok := h.lookupRoom(roomID)
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	notice := newSystemMessage(typeRoomClosed, NoticePayload{Message: message})
+	var closed int
+	var held []*detachedPeer
+	if !r.call(func() {
+		for id, c := range r.clients {
+			h.blockRejoin(roomID, id)
+			c.closeAfter(notice, typeRoomClosed, CloseRoomClosed, "room closed")
+		}
+		closed = len(r.clients)
+		for id, d := range r.detached {
+			h.blockRejoin(roomID, id)
+			held = append(held, d)
+		}
+	}) {
+		return ErrRoomNotFound
+	}
+
+	h.logger.Info("closing room", "room", roomID, "peers", closed, "detached", len(held))
+	for _, d := range held {
+		h.evictDetached(r, d)
+	}
+	return nil
+}
+
+// TakeDownBroadcast ends the broadcast of roomID. Every member receives
+// broadcast-ended with reason, and the broadcaster is then closed with
+// CloseBroadcastTakenDown; viewers see it leave as usual. The broadcaster
+// cannot rejoin the room for the rejoin block.
+func (h *Hub) TakeDownBroadcast(roomID, reason string) error {
+	if len(reason) > maxCloseReasonBytes {
+		return ErrCloseReasonTooLong
+	}
+	closeReason := reason
+	if closeReason == "" {
+		closeReason = "broadcast taken down"
+	}
+
+	r, ok := h.lookupRoom(roomID)
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	var peerID string
+	var held *detachedPeer
+	if !r.call(func() {
+		peerID = r.broadcaster
+		if peerID == "" {
+			return
+		}
+		h.blockRejoin(roomID, peerID)
+		notice := newSystemMessage(typeBroadcastEnded, BroadcastEndedPayload{Peer: peerID, Reason: reason})
+		for id, c := range r.clients {
+			if id == peerID {
+				c.closeAfter(notice, typeBroadcastEnded, CloseBroadcastTakenDown, closeReason)
+				continue
+			}
+			c.enqueue(outbound{data: notice, msgType: typeBroadcastEnded})
+		}
+		held = r.detached[peerID]
+	}) {
+		return ErrRoomNotFound
+	}
+	if peerID == "" {
+		return ErrNoBroadcaster
+	}
+
+	h.logger.Info("taking down broadcast", "room", roomID, "peer", peerID, "reason", reason)
+	if held != nil {
+		h.evictDetached(r, held)
+	}
+	return nil
+}
+
+// evictDetached releases the slot of a detached peer without waiting for its
+// grace period. Nothing happens if the grace period already elapsed.
+func (h *Hub) evictDetached(r *room, d *detachedPeer) {
+	if d.timer.Stop() {
+		h.expireDetached(r, d)
+	}
+}
+
+// blockRejoin keeps peerID from rejoining roomID for the rejoin block. It is
+// set before the peer is closed, so that it cannot reconnect in between.
+func (h *Hub) blockRejoin(roomID, peerID string) {
+	if h.rejoinBlock > 0 {
+		h.blocks.add(roomID, peerID, time.Now().Add(h.rejoinBlock))
+	}
+}
+
+// rejoinBlocks holds the peers an operator removed until their block ends.
+// Join tokens stay valid after a removal, so without it a peer could
+// reconnect right away.
+type rejoinBlocks struct {
+	mu    sync.Mutex
+	until map[roomPeer]time.Time
+}
+
+type roomPeer struct {
+	room, peer string
+}
+
+func (b *rejoinBlocks) add(roomID, peerID string, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for key, end := range b.until {
+		if !now.Before(end) {
+			delete(b.until, key)
+		}
+	}
+	if b.until == nil {
+		b.until = make(map[roomPeer]time.Time)
+	}
+	b.until[roomPeer{roomID, peerID}] = until
+}
+
+// blocked reports whether peerID may not join roomID yet.
+func (b *rejoinBlocks) blocked(roomID, peerID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	end, ok := b.until[roomPeer{roomID, peerID}]
+	return ok && time.Now().Before(end)
+}
+
+func (h *Hub) lookupRoom(roomID string) (*room, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r, ok := h.rooms[roomID]
+	return r, ok
+}
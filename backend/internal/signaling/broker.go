@@ -0,0 +1,75 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Broker shares room membership, presence and routed messages between hub
+// instances so that peers connected to different servers can meet in the
+// same room. Each hub identifies itself with a node ID.
+type Broker interface {
+	// Claim reserves m.Peer in room for m.Node. Claiming a peer ID the node
+	// already holds succeeds. It fails with ErrPeerClaimed when another node
+	// holds the peer ID, and with ErrBroadcasterClaimed when m is a
+	// broadcaster and the room already has another one.
+	Claim(ctx context.Context, room string, m Member) error
+	// Release drops the claim of m.Node on m.Peer. Releasing a peer ID the
+	// node does not hold is a no-op.
+	Release(ctx context.Context, room string, m Member) error
+	// Members lists the claimed peers of room across all nodes.
+	Members(ctx context.Context, room string) ([]Member, error)
+	// Publish delivers ev to every subscriber of room, including the
+	// publishing node.
+	Publish(ctx context.Context, room string, ev Event) error
+	// Subscribe calls fn with the events of room, one at a time and in
+	// publish order, until cancel is called.
+	Subscribe(ctx context.Context, room string, fn func(Event)) (cancel func(), err error)
+}
+
+var (
+	// ErrPeerClaimed is returned by Claim when another node holds the peer ID.
+	ErrPeerClaimed = fmt.Errorf("%w on another node", errPeerExists)
+	// ErrBroadcasterClaimed is returned by Claim when the room already has a
+	// broadcaster.
+	ErrBroadcasterClaimed = fmt.Errorf("%w on another node", errBroadcasterExists)
+)
+
+// Member is a peer claimed by a node.
+type Member struct {
+	Peer string `json:"peer"`
+	Role Role   `json:"role"`
+	Node string `json:"node"`
+}
+
+// EventKind tells what a broker event carries.
+type EventKind string
+
+const (
+	// EventJoin announces a peer that joined on the publishing node.
+	EventJoin EventKind = "join"
+	// EventLeave announces a peer that left the publishing node.
+	EventLeave EventKind = "leave"
+	// EventMessage carries a routed frame to the peers of other nodes.
+	EventMessage EventKind = "message"
+)
+
+// Event is published on a room's channel.
+type Event struct {
+	Kind EventKind `json:"kind"`
+	// Node is the node that published the event.
+	Node string `json:"node"`
+	// Member is the peer that joined or left, or the sender of a message.
+	Member Member `json:"member"`
+	// To, Type and Data describe a routed message; Data is the frame as the
+	// recipients receive it.
+	To   Recipients      `json:"to,omitempty"`
+	Type string          `json:"type,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// NewNodeID returns a random node ID for a hub.
+func NewNodeID() string {
+	return "node-" + randomPeerSuffix(12)
+}
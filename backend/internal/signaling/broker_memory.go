@@ -0,0 +1,195 @@
+package signaling
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryBroker is a Broker for hubs running in the same process. It is also
+// the state behind a BrokerServer.
+type MemoryBroker struct {
+	mu    sync.Mutex
+	rooms map[string]*brokerRoom
+}
+
+type brokerRoom struct {
+	members     map[string]Member
+	broadcaster string
+	subs        map[*subscription]struct{}
+}
+
+// NewMemoryBroker returns an empty MemoryBroker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{rooms: make(map[string]*brokerRoom)}
+}
+
+func (b *MemoryBroker) roomLocked(room string) *brokerRoom {
+	r, ok := b.rooms[room]
+	if !ok {
+		r = &brokerRoom{members: make(map[string]Member), subs: make(map[*subscription]struct{})}
+		b.rooms[room] = r
+	}
+	return r
+}
+
+func (b *MemoryBroker) pruneLocked(room string) {
+	if r, ok := b.rooms[room]; ok && len(r.members) == 0 && len(r.subs) == 0 {
+		delete(b.rooms, room)
+	}
+}
+
+// Claim implements Broker.
+func (b *MemoryBroker) Claim(_ context.Context, room string, m Member) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r := b.roomLocked(room)
+	if existing, ok := r.members[m.Peer]; ok && existing.Node != m.Node {
+		return ErrPeerClaimed
+	}
+	if m.Role == RoleBroadcaster && r.broadcaster != "" && r.broadcaster != m.Peer {
+		return ErrBroadcasterClaimed
+	}
+
+	if existing, ok := r.members[m.Peer]; ok && existing.Role == RoleBroadcaster && m.Role != RoleBroadcaster {
+		r.broadcaster = ""
+	}
+	r.members[m.Peer] = m
+	if m.Role == RoleBroadcaster {
+		r.broadcaster = m.Peer
+	}
+	return nil
+}
+
+// Release implements Broker.
+func (b *MemoryBroker) Release(_ context.Context, room string, m Member) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.rooms[room]
+	if !ok {
+		return nil
+	}
+	if existing, ok := r.members[m.Peer]; ok && existing.Node == m.Node {
+		delete(r.members, m.Peer)
+		if r.broadcaster == m.Peer {
+			r.broadcaster = ""
+		}
+	}
+	b.pruneLocked(room)
+	return nil
+}
+
+// Members implements Broker.
+func (b *MemoryBroker) Members(_ context.Context, room string) ([]Member, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.rooms[room]
+	if !ok {
+		return nil, nil
+	}
+	out := make([]Member, 0, len(r.members))
+	for _, m := range r.members {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out, nil
+}
+
+// Publish implements Broker.
+func (b *MemoryBroker) Publish(_ context.Context, room string, ev Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r, ok := b.rooms[room]; ok {
+		for sub := range r.subs {
+			sub.push(ev)
+		}
+	}
+	return nil
+}
+
+// Subscribe implements Broker.
+func (b *MemoryBroker) Subscribe(_ context.Context, room string, fn func(Event)) (func(), error) {
+	sub := newSubscription(fn)
+
+	b.mu.Lock()
+	b.roomLocked(room).subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			if r, ok := b.rooms[room]; ok {
+				delete(r.subs, sub)
+				b.pruneLocked(room)
+			}
+			b.mu.Unlock()
+			sub.stop()
+		})
+	}, nil
+}
+
+// subscription hands events to its callback on a dedicated goroutine, so a
+// slow subscriber never blocks the publisher and events keep their order.
+type subscription struct {
+	fn      func(Event)
+	mu      sync.Mutex
+	pending []Event
+	stopped bool
+	wake    chan struct{}
+}
+
+func newSubscription(fn func(Event)) *subscription {
+	s := &subscription{fn: fn, wake: make(chan struct{}, 1)}
+	go s.run()
+	return s
+}
+
+func (s *subscription) push(ev Event) {
+	s.mu.Lock()
+	if !s.stopped {
+		s.pending = append(s.pending, ev)
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscription) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.pending = nil
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if s.stopped {
+				s.mu.Unlock()
+				return
+			}
+			if len(s.pending) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			ev := s.pending[0]
+			s.pending = s.pending[1:]
+			s.mu.Unlock()
+
+			s.fn(ev)
+		}
+	}
+}
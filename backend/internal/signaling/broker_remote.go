@@ -0,0 +1,321 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	remoteBrokerMinBackoff = 100 * time.Millisecond
+	remoteBrokerMaxBackoff = 5 * time.Second
+)
+
+var (
+	errBrokerClosed         = errors.New("broker: closed")
+	errBrokerConnectionLost = errors.New("broker: connection lost")
+)
+
+// RemoteBrokerConfig configures a RemoteBroker.
+type RemoteBrokerConfig struct {
+	// URL is the websocket URL of a BrokerServer, e.g. ws://broker:8090/.
+	URL string
+	// Secret is presented as a bearer token when set.
+	Secret string
+	// Keepalive pings the broker server, so that a server that vanished
+	// without closing the connection is noticed and redialed. Zero values use
+	// the defaults.
+	Keepalive KeepaliveConfig
+	Logger    *slog.Logger
+}
+
+// RemoteBroker is a Broker backed by a BrokerServer. It connects in the
+// background and reconnects with backoff; after a reconnect it renews its
+// subscriptions and the claims it still holds. Calls made while disconnected
+// wait for the connection until their context ends.
+type RemoteBroker struct {
+	url       string
+	header    http.Header
+	keepalive KeepaliveConfig
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	connected chan struct{}
+	nextID    uint64
+	pending   map[uint64]chan brokerResponse
+	subs      map[uint64]*remoteSubscription
+	claims    map[claimKey]Member
+	writeMu   sync.Mutex
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type remoteSubscription struct {
+	room  string
+	queue *subscription
+}
+
+// NewRemoteBroker returns a RemoteBroker and starts connecting to cfg.URL.
+func NewRemoteBroker(cfg RemoteBrokerConfig) *RemoteBroker {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	header := http.Header{}
+	if cfg.Secret != "" {
+		header.Set("Authorization", "Bearer "+cfg.Secret)
+	}
+
+	b := &RemoteBroker{
+		url:       cfg.URL,
+		header:    header,
+		keepalive: cfg.Keepalive.withDefaults(),
+		logger:    logger.With("component", "broker"),
+		connected: make(chan struct{}),
+		pending:   make(map[uint64]chan brokerResponse),
+		subs:      make(map[uint64]*remoteSubscription),
+		claims:    make(map[claimKey]Member),
+		closed:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Close disconnects from the broker server, which then releases the claims
+// of this node.
+func (b *RemoteBroker) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+		b.mu.Lock()
+		conn := b.conn
+		b.mu.Unlock()
+		if conn != nil {
+			_ = conn.Close()
+		}
+	})
+	return nil
+}
+
+// run keeps a connection open until Close.
+func (b *RemoteBroker) run() {
+	backoff := remoteBrokerMinBackoff
+	for {
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(b.url, b.header)
+		if err != nil {
+			b.logger.Warn("failed to connect to broker", "url", b.url, "err", err, "retry_in", backoff)
+			select {
+			case <-b.closed:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, remoteBrokerMaxBackoff)
+			continue
+		}
+		backoff = remoteBrokerMinBackoff
+
+		b.mu.Lock()
+		b.conn = conn
+		close(b.connected)
+		b.mu.Unlock()
+		b.logger.Info("connected to broker", "url", b.url)
+
+		go b.restore()
+		b.readLoop(conn)
+
+		b.mu.Lock()
+		b.conn = nil
+		b.connected = make(chan struct{})
+		for id, ch := range b.pending {
+			ch <- brokerResponse{Error: errBrokerConnectionLost.Error()}
+			delete(b.pending, id)
+		}
+		b.mu.Unlock()
+		_ = conn.Close()
+		b.logger.Warn("lost connection to broker", "url", b.url)
+	}
+}
+
+func (b *RemoteBroker) readLoop(conn *websocket.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+	b.keepalive.watch(conn, done)
+
+	for {
+		var resp brokerResponse
+		if err := conn.ReadJSON(&resp); err != nil {
+			b.logger.Debug("broker connection read failed", "err", err)
+			return
+		}
+		b.keepalive.extend(conn)
+
+		b.mu.Lock()
+		if resp.Event != nil {
+			if sub, ok := b.subs[resp.Sub]; ok {
+				sub.queue.push(*resp.Event)
+			}
+		} else if ch, ok := b.pending[resp.ID]; ok {
+			delete(b.pending, resp.ID)
+			ch <- resp
+		}
+		b.mu.Unlock()
+	}
+}
+
+// restore renews the subscriptions and claims after a reconnect.
+func (b *RemoteBroker) restore() {
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+
+	b.mu.Lock()
+	subs := make(map[uint64]string, len(b.subs))
+	for id, sub := range b.subs {
+		subs[id] = sub.room
+	}
+	claims := make(map[claimKey]Member, len(b.claims))
+	for key, m := range b.claims {
+		claims[key] = m
+	}
+	b.mu.Unlock()
+
+	for id, room := range subs {
+		if _, err := b.call(ctx, brokerRequest{Op: brokerOpSubscribe, Room: room, Sub: id}); err != nil {
+			b.logger.Warn("failed to renew broker subscription", "room", room, "err", err)
+		}
+	}
+	for key, m := range claims {
+		if _, err := b.call(ctx, brokerRequest{Op: brokerOpClaim, Room: key.room, Member: m}); err != nil {
+			b.logger.Warn("failed to renew peer claim", "room", key.room, "peer", m.Peer, "err", err)
+		}
+	}
+}
+
+// call sends a request and waits for its response.
+func (b *RemoteBroker) call(ctx context.Context, req brokerRequest) (brokerResponse, error) {
+	var conn *websocket.Conn
+	for conn == nil {
+		b.mu.Lock()
+		conn = b.conn
+		ready := b.connected
+		b.mu.Unlock()
+		if conn != nil {
+			break
+		}
+		select {
+		case <-ready:
+		case <-b.closed:
+			return brokerResponse{}, errBrokerClosed
+		case <-ctx.Done():
+			return brokerResponse{}, ctx.Err()
+		}
+	}
+
+	ch := make(chan brokerResponse, 1)
+	b.mu.Lock()
+	b.nextID++
+	req.ID = b.nextID
+	b.pending[req.ID] = ch
+	b.mu.Unlock()
+
+	b.writeMu.Lock()
+	_ = conn.SetWriteDeadline(time.Now().Add(brokerWriteTimeout))
+	err := conn.WriteJSON(req)
+	b.writeMu.Unlock()
+	if err != nil {
+		b.forget(req.ID)
+		return brokerResponse{}, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, brokerError(resp.Error)
+	case <-ctx.Done():
+		b.forget(req.ID)
+		return brokerResponse{}, ctx.Err()
+	}
+}
+
+func (b *RemoteBroker) forget(id uint64) {
+	b.mu.Lock()
+	delete(b.pending, id)
+	b.mu.Unlock()
+}
+
+// Claim implements Broker.
+func (b *RemoteBroker) Claim(ctx context.Context, room string, m Member) error {
+	if _, err := b.call(ctx, brokerRequest{Op: brokerOpClaim, Room: room, Member: m}); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.claims[claimKey{room, m.Peer}] = m
+	b.mu.Unlock()
+	return nil
+}
+
+// Release implements Broker.
+func (b *RemoteBroker) Release(ctx context.Context, room string, m Member) error {
+	b.mu.Lock()
+	delete(b.claims, claimKey{room, m.Peer})
+	b.mu.Unlock()
+	_, err := b.call(ctx, brokerRequest{Op: brokerOpRelease, Room: room, Member: m})
+	return err
+}
+
+// Members implements Broker.
+func (b *RemoteBroker) Members(ctx context.Context, room string) ([]Member, error) {
+	resp, err := b.call(ctx, brokerRequest{Op: brokerOpMembers, Room: room})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Members, nil
+}
+
+// Publish implements Broker.
+func (b *RemoteBroker) Publish(ctx context.Context, room string, ev Event) error {
+	_, err := b.call(ctx, brokerRequest{Op: brokerOpPublish, Room: room, Event: &ev})
+	return err
+}
+
+// Subscribe implements Broker.
+func (b *RemoteBroker) Subscribe(ctx context.Context, room string, fn func(Event)) (func(), error) {
+	sub := &remoteSubscription{room: room, queue: newSubscription(fn)}
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		_, ok := b.subs[id]
+		delete(b.subs, id)
+		b.mu.Unlock()
+		if !ok {
+			return
+		}
+		sub.queue.stop()
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+			defer cancel()
+			_, _ = b.call(ctx, brokerRequest{Op: brokerOpUnsubscribe, Room: room, Sub: id})
+		}()
+	}
+
+	if _, err := b.call(ctx, brokerRequest{Op: brokerOpSubscribe, Room: room, Sub: id}); err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancel, nil
+}
@@ -0,0 +1,292 @@
+package signaling
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Broker protocol operations. Requests carry an ID that the response echoes;
+// events of a subscription are pushed with the subscription ID instead.
+const (
+	brokerOpClaim       = "claim"
+	brokerOpRelease     = "release"
+	brokerOpMembers     = "members"
+	brokerOpPublish     = "publish"
+	brokerOpSubscribe   = "subscribe"
+	brokerOpUnsubscribe = "unsubscribe"
+)
+
+// Error codes of broker responses that map to sentinel errors.
+const (
+	brokerErrPeerClaimed        = "peer_claimed"
+	brokerErrBroadcasterClaimed = "broadcaster_claimed"
+)
+
+const brokerWriteTimeout = 10 * time.Second
+
+type brokerRequest struct {
+	ID     uint64 `json:"id"`
+	Op     string `json:"op"`
+	Room   string `json:"room"`
+	Member Member `json:"member"`
+	Event  *Event `json:"event,omitempty"`
+	Sub    uint64 `json:"sub,omitempty"`
+}
+
+type brokerResponse struct {
+	ID      uint64   `json:"id,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Members []Member `json:"members,omitempty"`
+	// Sub and Event are set on pushed events.
+	Sub   uint64 `json:"sub,omitempty"`
+	Event *Event `json:"event,omitempty"`
+}
+
+func brokerErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrPeerClaimed):
+		return brokerErrPeerClaimed
+	case errors.Is(err, ErrBroadcasterClaimed):
+		return brokerErrBroadcasterClaimed
+	default:
+		return err.Error()
+	}
+}
+
+func brokerError(code string) error {
+	switch code {
+	case "":
+		return nil
+	case brokerErrPeerClaimed:
+		return ErrPeerClaimed
+	case brokerErrBroadcasterClaimed:
+		return ErrBroadcasterClaimed
+	default:
+		return errors.New("broker: " + code)
+	}
+}
+
+// BrokerServerConfig configures a BrokerServer.
+type BrokerServerConfig struct {
+	// Secret, when set, must be presented by nodes as a bearer token.
+	Secret string
+	// Keepalive pings the nodes, so that a node that vanished without closing
+	// its connection loses its claims. Zero values use the defaults.
+	Keepalive KeepaliveConfig
+	Logger    *slog.Logger
+}
+
+// BrokerServer shares a MemoryBroker with hubs that connect to it through a
+// RemoteBroker. Claims made over a connection are released, and announced as
+// leaves, when that connection drops.
+type BrokerServer struct {
+	broker    *MemoryBroker
+	secret    []byte
+	keepalive KeepaliveConfig
+	logger    *slog.Logger
+	upgrader  websocket.Upgrader
+
+	mu sync.Mutex
+	// owners maps each claim to the connection that made it, so a node that
+	// reconnected keeps the claims its new connection renewed.
+	owners map[claimKey]*brokerConn
+}
+
+type claimKey struct {
+	room string
+	peer string
+}
+
+// NewBrokerServer returns a BrokerServer with an empty MemoryBroker.
+func NewBrokerServer(cfg BrokerServerConfig) *BrokerServer {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &BrokerServer{
+		broker:    NewMemoryBroker(),
+		secret:    []byte(cfg.Secret),
+		keepalive: cfg.Keepalive.withDefaults(),
+		logger:    logger.With("component", "broker"),
+		owners:    make(map[claimKey]*brokerConn),
+	}
+}
+
+// ServeHTTP accepts a node connection.
+func (s *BrokerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if len(s.secret) > 0 {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), s.secret) != 1 {
+			s.logger.Warn("broker connection rejected: invalid secret", "remote", r.RemoteAddr)
+			http.Error(w, "invalid broker secret", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("failed to accept broker connection", "err", err, "remote", r.RemoteAddr)
+		return
+	}
+
+	bc := &brokerConn{server: s, conn: conn, subs: make(map[uint64]func())}
+	s.logger.Info("node connected", "remote", r.RemoteAddr)
+	bc.serve()
+	bc.close()
+	s.logger.Info("node disconnected", "remote", r.RemoteAddr)
+}
+
+// brokerConn is one node connection.
+type brokerConn struct {
+	server  *BrokerServer
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	subs map[uint64]func()
+}
+
+func (bc *brokerConn) write(resp brokerResponse) error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+	_ = bc.conn.SetWriteDeadline(time.Now().Add(brokerWriteTimeout))
+	return bc.conn.WriteJSON(resp)
+}
+
+func (bc *brokerConn) serve() {
+	done := make(chan struct{})
+	defer close(done)
+	keepalive := bc.server.keepalive
+	keepalive.watch(bc.conn, done)
+
+	for {
+		var req brokerRequest
+		if err := bc.conn.ReadJSON(&req); err != nil {
+			bc.server.logger.Debug("broker connection read failed", "err", err)
+			return
+		}
+		keepalive.extend(bc.conn)
+		resp := bc.handle(req)
+		resp.ID = req.ID
+		if err := bc.write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (bc *brokerConn) handle(req brokerRequest) brokerResponse {
+	s := bc.server
+	ctx := context.Background()
+	var err error
+
+	switch req.Op {
+	case brokerOpClaim:
+		s.mu.Lock()
+		err = s.broker.Claim(ctx, req.Room, req.Member)
+		if err == nil {
+			s.owners[claimKey{req.Room, req.Member.Peer}] = bc
+		}
+		s.mu.Unlock()
+	case brokerOpRelease:
+		s.mu.Lock()
+		key := claimKey{req.Room, req.Member.Peer}
+		if s.owners[key] == bc {
+			delete(s.owners, key)
+		}
+		err = s.broker.Release(ctx, req.Room, req.Member)
+		s.mu.Unlock()
+	case brokerOpMembers:
+		var members []Member
+		members, err = s.broker.Members(ctx, req.Room)
+		if err == nil {
+			return brokerResponse{Members: members}
+		}
+	case brokerOpPublish:
+		if req.Event == nil {
+			return brokerResponse{Error: "event is required"}
+		}
+		err = s.broker.Publish(ctx, req.Room, *req.Event)
+	case brokerOpSubscribe:
+		sub := req.Sub
+		var cancel func()
+		cancel, err = s.broker.Subscribe(ctx, req.Room, func(ev Event) {
+			_ = bc.write(brokerResponse{Sub: sub, Event: &ev})
+		})
+		if err == nil {
+			bc.mu.Lock()
+			if previous, ok := bc.subs[sub]; ok {
+				previous()
+			}
+			bc.subs[sub] = cancel
+			bc.mu.Unlock()
+		}
+	case brokerOpUnsubscribe:
+		bc.mu.Lock()
+		if cancel, ok := bc.subs[req.Sub]; ok {
+			cancel()
+			delete(bc.subs, req.Sub)
+		}
+		bc.mu.Unlock()
+	default:
+		return brokerResponse{Error: "unknown op " + req.Op}
+	}
+
+	if err != nil {
+		return brokerResponse{Error: brokerErrorCode(err)}
+	}
+	return brokerResponse{}
+}
+
+// close cancels the subscriptions of the connection and releases the claims
+// it still owns, announcing them as leaves.
+func (bc *brokerConn) close() {
+	_ = bc.conn.Close()
+
+	bc.mu.Lock()
+	for _, cancel := range bc.subs {
+		cancel()
+	}
+	bc.subs = nil
+	bc.mu.Unlock()
+
+	s := bc.server
+	ctx := context.Background()
+	type released struct {
+		room   string
+		member Member
+	}
+	var leaves []released
+
+	s.mu.Lock()
+	for key, owner := range s.owners {
+		if owner != bc {
+			continue
+		}
+		delete(s.owners, key)
+		members, _ := s.broker.Members(ctx, key.room)
+		for _, m := range members {
+			if m.Peer == key.peer {
+				_ = s.broker.Release(ctx, key.room, m)
+				leaves = append(leaves, released{room: key.room, member: m})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, l := range leaves {
+		s.logger.Info("released claim of disconnected node", "room", l.room, "peer", l.member.Peer, "node", l.member.Node)
+		_ = s.broker.Publish(ctx, l.room, Event{Kind: EventLeave, Node: l.member.Node, Member: l.member})
+	}
+}
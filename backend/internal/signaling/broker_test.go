@@ -0,0 +1,169 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testBrokerKeepalive notices a silent connection within a few dozen
+// milliseconds.
+var testBrokerKeepalive = KeepaliveConfig{PingInterval: 20 * time.Millisecond, PongTimeout: 30 * time.Millisecond}
+
+func TestMemoryBrokerClaims(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+
+	alice := Member{Peer: "alice", Role: RoleBroadcaster, Node: "a"}
+	if err := b.Claim(ctx, "room", alice); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if err := b.Claim(ctx, "room", alice); err != nil {
+		t.Fatalf("expected the owning node to claim again, got %v", err)
+	}
+
+	if err := b.Claim(ctx, "room", Member{Peer: "alice", Role: RoleViewer, Node: "b"}); !errors.Is(err, ErrPeerClaimed) {
+		t.Fatalf("expected ErrPeerClaimed, got %v", err)
+	}
+	if err := b.Claim(ctx, "room", Member{Peer: "carol", Role: RoleBroadcaster, Node: "b"}); !errors.Is(err, ErrBroadcasterClaimed) {
+		t.Fatalf("expected ErrBroadcasterClaimed, got %v", err)
+	}
+	if !errors.Is(ErrPeerClaimed, errPeerExists) || !errors.Is(ErrBroadcasterClaimed, errBroadcasterExists) {
+		t.Fatal("expected claim errors to match the local join errors")
+	}
+
+	if err := b.Release(ctx, "room", Member{Peer: "alice", Node: "b"}); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if members, _ := b.Members(ctx, "room"); len(members) != 1 {
+		t.Fatalf("expected a release from another node to be ignored, got %+v", members)
+	}
+
+	if err := b.Release(ctx, "room", alice); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if err := b.Claim(ctx, "room", Member{Peer: "carol", Role: RoleBroadcaster, Node: "b"}); err != nil {
+		t.Fatalf("expected the broadcaster slot to be free, got %v", err)
+	}
+}
+
+func TestMemoryBrokerDeliversEventsInOrder(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+
+	received := make(chan Event, 10)
+	cancel, err := b.Subscribe(ctx, "room", func(ev Event) { received <- ev })
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	for _, peer := range []string{"a", "b", "c"} {
+		if err := b.Publish(ctx, "room", Event{Kind: EventJoin, Member: Member{Peer: peer}}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+	if err := b.Publish(ctx, "other", Event{Kind: EventJoin, Member: Member{Peer: "x"}}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case ev := <-received:
+			if ev.Member.Peer != want {
+				t.Fatalf("expected %s, got %s", want, ev.Member.Peer)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	cancel()
+	_ = b.Publish(ctx, "room", Event{Kind: EventJoin, Member: Member{Peer: "d"}})
+	select {
+	case ev := <-received:
+		t.Fatalf("expected no event after cancel, got %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerServerReleasesClaimsOfSilentNode(t *testing.T) {
+	server := NewBrokerServer(BrokerServerConfig{
+		Keepalive: testBrokerKeepalive,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	alice := Member{Peer: "alice", Role: RoleBroadcaster, Node: "a"}
+	if err := conn.WriteJSON(brokerRequest{ID: 1, Op: brokerOpClaim, Room: "room", Member: alice}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp brokerResponse
+	if err := conn.ReadJSON(&resp); err != nil || resp.Error != "" {
+		t.Fatalf("claim failed: %v %q", err, resp.Error)
+	}
+
+	// the node stops reading, so it answers no pings, without closing the
+	// connection
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		members, _ := server.broker.Members(context.Background(), "room")
+		if len(members) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the claims of the silent node to be released, got %+v", members)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemoteBrokerRedialsSilentServer(t *testing.T) {
+	accepted := make(chan struct{}, 4)
+	stop := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		select {
+		case accepted <- struct{}{}:
+		default:
+		}
+		// never read, so pings go unanswered
+		<-stop
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(stop) })
+
+	b := NewRemoteBroker(RemoteBrokerConfig{
+		URL:       "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Keepalive: testBrokerKeepalive,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	defer b.Close()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-accepted:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected connection %d to the broker", i+1)
+		}
+	}
+}
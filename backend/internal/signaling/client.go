@@ -2,10 +2,11 @@ package signaling
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"log/slog"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,28 +20,59 @@ const (
 
 // Client keeps the WebSocket connection for a peer.
 type Client struct {
-	hub       *Hub
-	roomID    string
-	peerID    string
-	conn      *websocket.Conn
-	logger    *slog.Logger
-	send      chan []byte
+	hub *Hub
+	// room is set on register, before the client runs.
+	room    *room
+	roomID  string
+	peerID  string
+	role    Role
+	conn    *websocket.Conn
+	logger  *slog.Logger
+	queue   *sendQueue
+	dropped atomic.Uint64
+	// rtt is the latest ping round-trip time in nanoseconds.
+	rtt       atomic.Int64
 	done      chan struct{}
 	closeOnce sync.Once
+	// expiresAt is the expiry of the join token; zero when unauthenticated.
+	expiresAt time.Time
+	// resumeToken is issued on join; resumeRequest is the token presented by
+	// the client to take over a held session.
+	resumeToken   string
+	resumeRequest string
+	// closing is set once the hub decided to close the connection.
+	closing atomic.Bool
+	// detachable is set by the read loop when the socket dropped unexpectedly.
+	detachable bool
+	// remoteAddr and connectedAt describe the connection for operators.
+	remoteAddr  string
+	connectedAt time.Time
+	// routing holds a slot for each message of the client waiting in its
+	// room's inbox.
+	routing chan struct{}
 }
 
-func newClient(hub *Hub, roomID, peerID string, conn *websocket.Conn) *Client {
+func newClient(hub *Hub, roomID, peerID string, role Role, conn *websocket.Conn) *Client {
 	return &Client{
-		hub:    hub,
-		roomID: roomID,
-		peerID: peerID,
-		conn:   conn,
-		logger: hub.logger.With("room", roomID, "peer", peerID),
-		send:   make(chan []byte, queueSize),
-		done:   make(chan struct{}),
+		hub:         hub,
+		roomID:      roomID,
+		peerID:      peerID,
+		role:        role,
+		conn:        conn,
+		logger:      hub.logger.With("room", roomID, "peer", peerID, "role", role),
+		queue:       newSendQueue(hub.slowConsumer.QueueSize),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+		routing:     make(chan struct{}, max(1, hub.slowConsumer.QueueSize/2)),
 	}
 }
 
+// setPeerID renames the client before it is registered.
+func (c *Client) setPeerID(peerID string) {
+	c.peerID = peerID
+	c.logger = c.hub.logger.With("room", c.roomID, "peer", peerID, "role", c.role)
+}
+
 // run starts the read/write loops for the client.
 func (c *Client) run(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
@@ -48,6 +80,25 @@ func (c *Client) run(ctx context.Context) {
 
 	c.conn.SetReadLimit(maxMessageBytes)
 
+	if keepalive := c.hub.keepalive; keepalive.enabled() {
+		_ = c.conn.SetReadDeadline(keepalive.readDeadline(time.Now()))
+		c.conn.SetPongHandler(func(appData string) error {
+			now := time.Now()
+			if rtt, ok := decodePong(appData, now); ok {
+				c.rtt.Store(int64(rtt))
+				c.logger.Debug("pong received", "rtt", rtt)
+			}
+			return c.conn.SetReadDeadline(keepalive.readDeadline(now))
+		})
+	}
+
+	if !c.expiresAt.IsZero() {
+		expiry := time.AfterFunc(time.Until(c.expiresAt), func() {
+			c.closeWithCode(CloseTokenExpired, "token expired")
+		})
+		defer expiry.Stop()
+	}
+
 	go func() {
 		<-ctx.Done()
 		_ = c.conn.WriteControl(
@@ -70,28 +121,70 @@ func (c *Client) readLoop(ctx context.Context) {
 		_ = c.conn.Close()
 	}()
 
+	limiter := newRateLimiter(c.hub.rateLimit, time.Now())
+
 	for {
 		msgType, data, err := c.conn.ReadMessage()
 		if err != nil {
-			if !errors.Is(err, context.Canceled) {
+			c.detachable = !c.closing.Load() && !websocket.IsCloseError(err, websocket.CloseNormalClosure)
+
+			var netErr net.Error
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				c.logger.InfoContext(ctx, "evicting unresponsive peer", "rtt", c.RTT())
+			case !errors.Is(err, context.Canceled):
 				c.logger.DebugContext(ctx, "read loop ended", "err", err)
 			}
 			return
 		}
 
+		now := time.Now()
+		if c.hub.keepalive.enabled() {
+			_ = c.conn.SetReadDeadline(c.hub.keepalive.readDeadline(now))
+		}
+		if !limiter.allowFrame(now) {
+			if c.rejectRateLimited(ctx, limiter, now, newError(CodeRateLimited, "rate limit exceeded")) {
+				return
+			}
+			continue
+		}
+
 		if msgType != websocket.TextMessage {
-			c.sendError("only text messages are supported")
+			c.sendError(newError(CodeUnsupportedFrame, "only text messages are supported"))
 			continue
 		}
 
-		var msg Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			c.sendError("invalid message format")
+		msg, err := decodeMessage(data, c.hub.inspects)
+		if err != nil {
+			c.sendError(newError(CodeInvalidMessage, "invalid message format"))
 			continue
 		}
+		msg.Seq, msg.TS = 0, now.UnixMilli()
 
 		if msg.Type == "" {
-			c.sendError("message type is required")
+			c.sendError(messageError(CodeMissingType, "message type is required", msg))
+			continue
+		}
+
+		if err := c.hub.schemas.check(msg.Type, len(data), msg.Payload); err != nil {
+			c.sendError(schemaError(err, msg))
+			continue
+		}
+
+		if msg.Ack && msg.ID == "" {
+			c.sendError(messageError(CodeInvalidMessage, "ack requires a message id", msg))
+			continue
+		}
+
+		if msg.Retain && len(msg.To) > 0 {
+			c.sendError(messageError(CodeInvalidMessage, "retained messages cannot be targeted", msg))
+			continue
+		}
+
+		if !limiter.allowType(msg.Type, now) {
+			if c.rejectRateLimited(ctx, limiter, now, messageError(CodeRateLimited, "rate limit exceeded", msg)) {
+				return
+			}
 			continue
 		}
 
@@ -100,65 +193,209 @@ func (c *Client) readLoop(ctx context.Context) {
 	}
 }
 
+// rejectRateLimited answers an over-limit frame with reply and reports
+// whether the peer was disconnected for repeated violations.
+func (c *Client) rejectRateLimited(ctx context.Context, limiter *rateLimiter, now time.Time, reply ErrorPayload) bool {
+	if limiter.violate(now) {
+		c.logger.WarnContext(ctx, "disconnecting peer: rate limit exceeded repeatedly")
+		c.closeWithCode(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return true
+	}
+
+	c.sendError(reply)
+	return false
+}
+
 func (c *Client) writeLoop(ctx context.Context) {
+	var ping <-chan time.Time
+	if c.hub.keepalive.enabled() {
+		ticker := time.NewTicker(c.hub.keepalive.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-c.done:
 			return
-		default:
+		case now := <-ping:
+			if err := c.conn.WriteControl(websocket.PingMessage, encodePing(now), now.Add(writeTimeout)); err != nil {
+				c.logger.DebugContext(ctx, "ping failed", "err", err)
+				return
+			}
+			continue
+		case <-c.queue.ready:
 		}
 
-		select {
-		case <-ctx.Done():
-			return
-		case <-c.done:
-			return
-		case data := <-c.send:
+		c.hub.metrics.queueDepth.Observe(float64(c.queue.len()))
+		for {
+			item, ok := c.queue.pop()
+			if !ok {
+				break
+			}
+
 			if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
 				c.logger.DebugContext(ctx, "failed to set write deadline", "err", err)
 				return
 			}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			start := time.Now()
+			err := item.write(c.conn)
+			c.hub.metrics.observeWrite(start)
+			if err != nil {
 				c.logger.DebugContext(ctx, "write failed", "err", err)
+				acknowledge(item, c.peerID, AckTargetGone)
+				return
+			}
+			c.logger.DebugContext(ctx, "outbound message sent", "type", item.msgType)
+			acknowledge(item, c.peerID, AckDelivered)
+			if item.closeCode != 0 {
+				c.closeWithCode(item.closeCode, item.closeReason)
 				return
 			}
-			c.logger.DebugContext(ctx, "outbound message sent")
 		}
 	}
 }
 
-func (c *Client) enqueue(data []byte) {
+// RTT returns the latest measured signaling round-trip time, or zero before
+// the first pong.
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// enqueueResult is the outcome of Client.enqueue.
+type enqueueResult int
+
+const (
+	// enqueueRejected means the frame was dropped and its sender told.
+	enqueueRejected enqueueResult = iota
+	// enqueueQueued means the frame is in the send queue.
+	enqueueQueued
+	// enqueuePending means the frame waits for space under SlowConsumerBlock.
+	// It may still be dropped, in which case handoff tells its sender.
+	enqueuePending
+)
+
+// enqueue queues item according to the hub's slow-consumer policy and
+// reports whether it was queued, is waiting for space or was dropped.
+func (c *Client) enqueue(item outbound) enqueueResult {
 	select {
 	case <-c.done:
-		return
+		acknowledge(item, c.peerID, AckTargetGone)
+		return enqueueRejected
 	default:
 	}
 
-	// duplicate the slice as it might be reused by callers
-	copyBuf := make([]byte, len(data))
-	copy(copyBuf, data)
+	if c.queue.push(item) {
+		return enqueueQueued
+	}
 
-	select {
-	case <-c.done:
-		return
-	case c.send <- copyBuf:
-		return
+	switch c.hub.slowConsumer.Policy {
+	case SlowConsumerDisconnect:
+		c.drop(item, "send queue full")
+		c.closing.Store(true)
+		c.shutdown()
+		go c.closeWithCode(CloseSlowConsumer, "send queue full")
+		return enqueueRejected
+	case SlowConsumerBlock:
+		if c.queue.block(item, time.Now().Add(c.hub.slowConsumer.BlockTimeout)) {
+			go c.handoff()
+		}
+		return enqueuePending
 	default:
-		c.logger.Warn("dropping message: send queue full")
+		if !isPriorityType(item.msgType) {
+			c.drop(item, "send queue full")
+			return enqueueRejected
+		}
+		evicted, hasEvicted, ok := c.queue.pushEvicting(item)
+		if hasEvicted {
+			c.drop(evicted, "evicted by priority message")
+		}
+		if !ok {
+			c.drop(item, "send queue full")
+			return enqueueRejected
+		}
+		return enqueueQueued
+	}
+}
+
+// handoff moves the frames held by SlowConsumerBlock into the queue as the
+// write loop makes space, and drops those that waited too long. It runs apart
+// from the room goroutine so that a slow peer does not hold up the others.
+func (c *Client) handoff() {
+	timer := time.NewTimer(c.hub.slowConsumer.BlockTimeout)
+	defer timer.Stop()
+
+	for {
+		expired, next, waiting := c.queue.unblock(time.Now())
+		for _, item := range expired {
+			c.drop(item, "send queue full after timeout")
+		}
+		if !waiting {
+			return
+		}
+
+		timer.Reset(time.Until(next))
+		select {
+		case <-c.done:
+			// leaving or detaching drains the held frames
+			return
+		case <-timer.C:
+		case <-c.queue.space:
+		}
+	}
+}
+
+// drop records a frame that will not be delivered and tells its sender.
+func (c *Client) drop(item outbound, reason string) {
+	total := c.dropped.Add(1)
+	c.hub.dropped.Add(1)
+	c.logger.Warn("dropping message", "reason", reason, "type", item.msgType, "dropped_total", total)
+
+	if item.from != c {
+		reportDropped(item, c.peerID)
 	}
 }
 
 func (c *Client) formatMessage(msg Message) ([]byte, error) {
 	msg.From = c.peerID
-	return json.Marshal(msg)
+	return msg.encode()
+}
+
+func (c *Client) sendError(e ErrorPayload) {
+	c.logger.Warn("sending error", "code", e.Code, "message", e.Message, "ref", e.Ref)
+	c.enqueue(outbound{data: newErrorPayload(e), msgType: typeError})
+}
+
+// closeWithCode sends a close frame with the given code and tears down the
+// connection. The read loop then unregisters the client.
+func (c *Client) closeWithCode(code int, reason string) {
+	c.closing.Store(true)
+	c.logger.Info("closing connection", "close_code", code, "reason", reason)
+	_ = c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(writeTimeout),
+	)
+	_ = c.conn.Close()
+	c.shutdown()
 }
 
-func (c *Client) sendError(msg string) {
-	c.logger.Warn("sending error", "message", msg)
-	c.enqueue(newErrorPayload(msg))
+// closeAfter queues notice, bypassing the queue limit, and closes the
+// connection with code once it and the frames before it are written. The
+// connection is closed anyway after closeGracePeriod.
+func (c *Client) closeAfter(notice []byte, msgType string, code int, reason string) {
+	c.closing.Store(true)
+	c.queue.pushUnbounded([]outbound{{data: notice, msgType: msgType, closeCode: code, closeReason: reason}})
+	time.AfterFunc(closeGracePeriod, func() {
+		select {
+		case <-c.done:
+		default:
+			c.closeWithCode(code, reason)
+		}
+	})
 }
 
 func (c *Client) shutdown() {
@@ -0,0 +1,36 @@
+package signaling
+
+import "github.com/gorilla/websocket"
+
+// Close codes sent by the hub in addition to the RFC 6455 codes. They use the
+// 4000-4999 range reserved for applications.
+const (
+	// CloseTokenExpired is sent when the join token of a connected peer expires.
+	CloseTokenExpired = 4001
+	// CloseSlowConsumer is sent when a peer cannot keep up with its send queue.
+	CloseSlowConsumer = 4002
+	// CloseReplaced is sent to a stale connection taken over by a new one.
+	CloseReplaced = 4003
+	// CloseKicked is the default code sent to a peer an operator removed.
+	CloseKicked = 4004
+	// CloseRoomClosed is sent to every member of a room an operator closed.
+	CloseRoomClosed = 4005
+	// CloseBroadcastTakenDown is sent to a broadcaster an operator took down.
+	CloseBroadcastTakenDown = 4006
+)
+
+// maxCloseReasonBytes is the longest reason that fits in a close frame next
+// to its code.
+const maxCloseReasonBytes = 123
+
+// validCloseCode reports whether code may be sent in a close frame: the RFC
+// 6455 codes an endpoint may send, and the registered and application ranges.
+func validCloseCode(code int) bool {
+	switch code {
+	case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseProtocolError,
+		websocket.CloseUnsupportedData, websocket.CloseInvalidFramePayloadData,
+		websocket.ClosePolicyViolation, websocket.CloseMessageTooBig, websocket.CloseInternalServerErr:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
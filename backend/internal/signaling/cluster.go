@@ -0,0 +1,374 @@
+package signaling
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// brokerTimeout bounds every broker call, so that joins fail rather than hang
+// while the broker is unreachable.
+const brokerTimeout = 5 * time.Second
+
+// acquireRoom returns the room, creating it if needed, and counts the caller
+// as joining it until the join operation runs. With a broker the room is
+// first attached to it, so that its roster of remote peers is known before
+// anyone joins.
+func (h *Hub) acquireRoom(ctx context.Context, roomID string) (*room, error) {
+	h.mu.Lock()
+	r, ok := h.rooms[roomID]
+	if !ok {
+		r = newRoom(roomID, h)
+		h.rooms[roomID] = r
+	}
+	r.joining.Add(1)
+	h.mu.Unlock()
+
+	if err := r.attach(ctx); err != nil {
+		r.joining.Add(-1)
+		// let the room goroutine delete the room if it stayed empty
+		r.do(func() {})
+		return nil, err
+	}
+	return r, nil
+}
+
+// attach subscribes the room to its broker channel and loads the peers
+// claimed by other nodes. It does nothing once the room is attached.
+func (r *room) attach(ctx context.Context) error {
+	if r.hub.broker == nil {
+		return nil
+	}
+	r.brokerMu.Lock()
+	defer r.brokerMu.Unlock()
+	if r.cancel != nil || r.brokerClosed {
+		return nil
+	}
+
+	ctx, cancelCtx := context.WithTimeout(ctx, brokerTimeout)
+	defer cancelCtx()
+
+	cancel, err := r.hub.broker.Subscribe(ctx, r.id, r.handleEvent)
+	if err != nil {
+		return err
+	}
+	members, err := r.hub.broker.Members(ctx, r.id)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	// the caller is joining, so the room cannot be deleted meanwhile
+	r.call(func() {
+		for _, m := range members {
+			if m.Node != r.hub.node {
+				r.remote[m.Peer] = m
+			}
+		}
+	})
+	r.cancel = cancel
+	return nil
+}
+
+// detach stops the broker subscription of a deleted room.
+func (r *room) detach() {
+	if r.hub.broker == nil {
+		return
+	}
+	r.brokerMu.Lock()
+	defer r.brokerMu.Unlock()
+	r.brokerClosed = true
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// claimJoin reserves the peer ID c is about to join under across nodes, when
+// this node does not hold it yet. It runs before addClient, so that nothing
+// is handed to c when the claim fails. Joins to the room wait for each other
+// until done is called, which keeps the ID addClient picks the claimed one;
+// done drops the claim when the join failed after all.
+func (r *room) claimJoin(ctx context.Context, c *Client) (done func(failed bool), err error) {
+	if r.hub.broker == nil {
+		return func(bool) {}, nil
+	}
+	r.joinMu.Lock()
+
+	var action joinAction
+	var peerID string
+	r.call(func() { action, peerID, err = r.planJoin(c) })
+	if err != nil || (action != joinFresh && action != joinSuffix) {
+		// addClient reports the error, and resumed or replaced sessions
+		// already hold their claim
+		return func(bool) { r.joinMu.Unlock() }, nil
+	}
+
+	c.setPeerID(peerID)
+	m := r.hub.memberOf(peerID, c.role)
+	claimCtx, cancel := context.WithTimeout(ctx, brokerTimeout)
+	defer cancel()
+	if err := r.hub.broker.Claim(claimCtx, r.id, m); err != nil {
+		r.joinMu.Unlock()
+		return nil, err
+	}
+	return func(failed bool) {
+		if failed {
+			r.releaseClaim(m)
+		}
+		r.joinMu.Unlock()
+	}, nil
+}
+
+// releaseClaim drops the claim of a peer that left this node.
+func (r *room) releaseClaim(m Member) {
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	if err := r.hub.broker.Release(ctx, r.id, m); err != nil {
+		r.logger.Warn("failed to release peer claim", "peer", m.Peer, "err", err)
+	}
+}
+
+// publishJoin queues the join of a local peer for the other nodes. It is
+// called from the room goroutine.
+func (r *room) publishJoin(peerID string, role Role) {
+	if r.outbox == nil {
+		return
+	}
+	r.outbox.push(forwarding{ev: Event{Kind: EventJoin, Member: r.hub.memberOf(peerID, role)}})
+}
+
+// publishLeave queues the departure of a local peer for the other nodes. With
+// release its claim is dropped as well, once the frames routed before have
+// been published. It is called from the room goroutine.
+func (r *room) publishLeave(peerID string, role Role, release bool) {
+	if r.outbox == nil {
+		return
+	}
+	r.outbox.push(forwarding{ev: Event{Kind: EventLeave, Member: r.hub.memberOf(peerID, role)}, release: release})
+}
+
+// publish sends an event of this node on the room's channel.
+func (r *room) publish(ev Event) bool {
+	h := r.hub
+	if h.broker == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+
+	ev.Node = h.node
+	if err := h.broker.Publish(ctx, r.id, ev); err != nil {
+		r.logger.Warn("failed to publish broker event", "kind", ev.Kind, "peer", ev.Member.Peer, "err", err)
+		return false
+	}
+	return true
+}
+
+// forwarding is an event waiting to be published to other nodes.
+type forwarding struct {
+	ev Event
+	// release drops the claim of the departed peer of a leave event first.
+	release bool
+	// done, if set, receives whether the publish succeeded.
+	done func(ok bool)
+}
+
+// outbox carries the events of a room to the broker in the order the room
+// goroutine produced them. Routed messages are refused while roomInboxSize
+// of them wait, so that a stalled broker cannot hold up the room. Joins and
+// leaves are always queued, as other nodes must not miss a membership
+// change.
+type outbox struct {
+	mu       sync.Mutex
+	items    []forwarding
+	messages int
+	closed   bool
+	ready    chan struct{}
+}
+
+func newOutbox() *outbox {
+	return &outbox{ready: make(chan struct{}, 1)}
+}
+
+// push queues f and reports false when f is a message and the outbox is full
+// of them.
+func (o *outbox) push(f forwarding) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if f.ev.Kind == EventMessage {
+		if o.messages >= roomInboxSize {
+			return false
+		}
+		o.messages++
+	}
+	o.items = append(o.items, f)
+	signal(o.ready)
+	return true
+}
+
+// close makes next report false once the queued events are taken.
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	signal(o.ready)
+}
+
+// next waits for the oldest queued event. It reports false once the outbox is
+// closed and empty.
+func (o *outbox) next() (forwarding, bool) {
+	for {
+		o.mu.Lock()
+		if len(o.items) > 0 {
+			f := o.items[0]
+			o.items[0] = forwarding{}
+			o.items = o.items[1:]
+			if f.ev.Kind == EventMessage {
+				o.messages--
+			}
+			o.mu.Unlock()
+			return f, true
+		}
+		closed := o.closed
+		o.mu.Unlock()
+
+		if closed {
+			return forwarding{}, false
+		}
+		<-o.ready
+	}
+}
+
+// publishLoop publishes the events of the outbox in order. It runs apart from
+// the room goroutine so that a slow broker does not hold up local delivery.
+func (r *room) publishLoop() {
+	for {
+		f, ok := r.outbox.next()
+		if !ok {
+			return
+		}
+		if f.release {
+			r.releaseClaim(f.ev.Member)
+		}
+		ok = r.publish(f.ev)
+		if f.done != nil {
+			f.done(ok)
+		}
+	}
+}
+
+// forward queues a routed message for the peers of other nodes. The room
+// goroutine never waits for the broker: when the outbox is full the message
+// is dropped and its sender told, through done when set.
+func (r *room) forward(from *Client, msg Message, item outbound, done func(ok bool)) {
+	f := forwarding{
+		ev: Event{
+			Kind:   EventMessage,
+			Member: r.hub.memberOf(from.peerID, from.role),
+			To:     msg.To,
+			Type:   msg.Type,
+			Data:   item.data,
+		},
+		done: done,
+	}
+	if r.outbox.push(f) {
+		return
+	}
+
+	r.hub.dropped.Add(1)
+	r.logger.Warn("dropping message for other nodes", "reason", "broker outbox full", "peer", from.peerID, "type", msg.Type)
+	if done != nil {
+		done(false)
+		return
+	}
+	from.sendError(messageError(CodeDeliveryFailed, "message could not be forwarded to other nodes", msg))
+}
+
+// forwardTo routes a message to a single peer of another node. With an ack
+// requested, a successful publish counts as delivered.
+func (r *room) forwardTo(from *Client, to string, role Role, msg Message, item outbound) {
+	if !canReach(from.role, role) {
+		from.sendError(messageError(CodeTargetNotAllowed, "target peer not allowed", msg))
+		return
+	}
+	r.forward(from, msg, item, func(ok bool) { forwarded(item, to, ok) })
+}
+
+// forwarded reports the outcome of publishing item for a peer of another
+// node to its sender.
+func forwarded(item outbound, to string, ok bool) {
+	if !ok {
+		reportDropped(item, to)
+		return
+	}
+	acknowledge(item, to, AckDelivered)
+}
+
+// remoteBroadcaster returns the broadcaster claimed by another node.
+func (r *room) remoteBroadcaster() (string, bool) {
+	for id, m := range r.remote {
+		if m.Role == RoleBroadcaster {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// handleEvent queues an event published by another node for the room
+// goroutine.
+func (r *room) handleEvent(ev Event) {
+	if ev.Node == r.hub.node {
+		return
+	}
+	r.do(func() { r.applyEvent(ev) })
+}
+
+func (r *room) applyEvent(ev Event) {
+	switch ev.Kind {
+	case EventJoin:
+		m := ev.Member
+		if _, known := r.remote[m.Peer]; known {
+			r.remote[m.Peer] = m
+			return
+		}
+		r.remote[m.Peer] = m
+
+		r.logger.Info("remote peer joined", "peer", m.Peer, "role", m.Role, "node", m.Node)
+		notice := newSystemMessage(typePeerJoined, PresencePayload{Peer: m.Peer, Role: m.Role})
+		for _, client := range r.clients {
+			if canReach(m.Role, client.role) {
+				client.enqueue(outbound{data: notice, msgType: typePeerJoined})
+			}
+		}
+	case EventLeave:
+		m := ev.Member
+		if current, ok := r.remote[m.Peer]; !ok || current.Node != m.Node {
+			return
+		}
+		delete(r.remote, m.Peer)
+
+		r.logger.Info("remote peer left", "peer", m.Peer, "role", m.Role, "node", m.Node)
+		announceLeave(m.Peer, m.Role, r.list())
+	case EventMessage:
+		r.deliverRemote(ev)
+	}
+}
+
+// deliverRemote hands a message routed on another node to the local peers it
+// addresses. Delivery problems are not reported back to the sender.
+func (r *room) deliverRemote(ev Event) {
+	clients, detached, _ := r.resolve(ev.Member.Peer, ev.Member.Role, ev.To)
+	item := outbound{data: ev.Data, msgType: ev.Type}.shared(len(clients))
+	for _, client := range clients {
+		client.enqueue(item)
+	}
+	for _, peerID := range detached {
+		r.hold(peerID, item)
+	}
+}
+
+func (h *Hub) memberOf(peerID string, role Role) Member {
+	return Member{Peer: peerID, Role: role, Node: h.node}
+}
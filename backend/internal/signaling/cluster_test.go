@@ -0,0 +1,223 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stallingBroker holds every published message until release is closed, as
+// a broker that stopped answering would. stalled is signalled when a publish
+// starts waiting.
+type stallingBroker struct {
+	*MemoryBroker
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (b *stallingBroker) Publish(ctx context.Context, room string, ev Event) error {
+	if ev.Kind == EventMessage {
+		select {
+		case b.stalled <- struct{}{}:
+		default:
+		}
+		select {
+		case <-b.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return b.MemoryBroker.Publish(ctx, room, ev)
+}
+
+func TestRoomDropsForwardedMessagesWhenBrokerStalls(t *testing.T) {
+	const sent = roomInboxSize + 4
+
+	ctx := context.Background()
+	mem := NewMemoryBroker()
+	if err := mem.Claim(ctx, "stall", Member{Peer: "remote", Role: RoleViewer, Node: "node-b"}); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	broker := &stallingBroker{MemoryBroker: mem, stalled: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(broker.release)
+
+	hub := NewHub(HubConfig{
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SlowConsumer: SlowConsumerConfig{QueueSize: 2 * sent},
+		Broker:       broker,
+		NodeID:       "node-a",
+	})
+	sender := newClient(hub, "stall", "alice", RoleBroadcaster, nil)
+	if err := hub.register(ctx, sender); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	for i := 0; i < sent; i++ {
+		hub.dispatch(ctx, sender, Message{ID: fmt.Sprintf("m%d", i), Type: "note", To: Recipients{"remote"}, Ack: true, Payload: json.RawMessage(`{}`)})
+		if i == 0 {
+			<-broker.stalled
+		}
+	}
+	routed := make(chan struct{})
+	go func() {
+		sender.room.call(func() {})
+		close(routed)
+	}()
+	select {
+	case <-routed:
+	case <-time.After(time.Second):
+		t.Fatal("room goroutine blocked on the stalled broker")
+	}
+
+	// one message is being published and roomInboxSize wait in the outbox
+	const wantDropped = sent - roomInboxSize - 1
+	dropped := 0
+	for {
+		item, ok := sender.queue.pop()
+		if !ok {
+			break
+		}
+		if item.msgType != typeAck {
+			continue
+		}
+		var msg struct {
+			Payload AckPayload `json:"payload"`
+		}
+		if err := json.Unmarshal(item.data, &msg); err != nil {
+			t.Fatalf("invalid ack: %v", err)
+		}
+		if msg.Payload.Status != AckDropped || msg.Payload.To != "remote" {
+			t.Fatalf("unexpected ack %+v", msg.Payload)
+		}
+		dropped++
+	}
+	if dropped != wantDropped {
+		t.Fatalf("expected %d dropped acks, got %d", wantDropped, dropped)
+	}
+	if got := hub.dropped.Load(); got != wantDropped {
+		t.Fatalf("expected %d dropped frames, got %d", wantDropped, got)
+	}
+}
+
+// refusingBroker fails every claim while refuse is set.
+type refusingBroker struct {
+	*MemoryBroker
+	refuse atomic.Bool
+}
+
+func (b *refusingBroker) Claim(ctx context.Context, room string, m Member) error {
+	if b.refuse.Load() {
+		return errors.New("broker unavailable")
+	}
+	return b.MemoryBroker.Claim(ctx, room, m)
+}
+
+func TestRegisterKeepsMailWhenClaimFails(t *testing.T) {
+	ctx := context.Background()
+	broker := &refusingBroker{MemoryBroker: NewMemoryBroker()}
+	hub := NewHub(HubConfig{
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Mailbox: MailboxConfig{TTL: time.Minute},
+		Broker:  broker,
+		NodeID:  "node-a",
+	})
+	sender := newClient(hub, "mail", "alice", RoleBroadcaster, nil)
+	if err := hub.register(ctx, sender); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	hub.dispatch(ctx, sender, Message{ID: "m1", Type: "note", To: Recipients{"bob"}, Payload: json.RawMessage(`{}`)})
+
+	broker.refuse.Store(true)
+	refused := newClient(hub, "mail", "bob", RoleViewer, nil)
+	if err := hub.register(ctx, refused); err == nil {
+		t.Fatal("expected the claim to fail")
+	}
+	if n := refused.queue.len(); n != 0 {
+		t.Fatalf("expected nothing queued for the refused client, got %d frames", n)
+	}
+
+	broker.refuse.Store(false)
+	bob := newClient(hub, "mail", "bob", RoleViewer, nil)
+	if err := hub.register(ctx, bob); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	for {
+		item, ok := bob.queue.pop()
+		if !ok {
+			t.Fatal("mail was lost with the refused join")
+		}
+		if item.msgType == "note" {
+			break
+		}
+	}
+}
+
+// recordingBroker records the membership events published to it.
+type recordingBroker struct {
+	*MemoryBroker
+	mu     sync.Mutex
+	events []Event
+}
+
+func (b *recordingBroker) Publish(ctx context.Context, room string, ev Event) error {
+	b.mu.Lock()
+	if ev.Kind != EventMessage {
+		b.events = append(b.events, ev)
+	}
+	b.mu.Unlock()
+	return b.MemoryBroker.Publish(ctx, room, ev)
+}
+
+func TestRoomPublishesMembershipInOrder(t *testing.T) {
+	ctx := context.Background()
+	broker := &recordingBroker{MemoryBroker: NewMemoryBroker()}
+	hub := NewHub(HubConfig{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Broker: broker,
+		NodeID: "node-a",
+	})
+	keeper := newClient(hub, "order", "keeper", RoleViewer, nil)
+	if err := hub.register(ctx, keeper); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		c := newClient(hub, "order", "bob", RoleViewer, nil)
+		if err := hub.register(ctx, c); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+		hub.unregister(ctx, c)
+	}
+	keeper.room.call(func() {})
+
+	want := []string{"join keeper", "join bob", "leave bob", "join bob", "leave bob", "join bob", "leave bob"}
+	deadline := time.Now().Add(time.Second)
+	for {
+		broker.mu.Lock()
+		got := make([]string, 0, len(broker.events))
+		for _, ev := range broker.events {
+			got = append(got, string(ev.Kind)+" "+ev.Member.Peer)
+		}
+		broker.mu.Unlock()
+		if fmt.Sprint(got) == fmt.Sprint(want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected events %v, got %v", want, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	members, err := broker.Members(ctx, "order")
+	if err != nil {
+		t.Fatalf("members failed: %v", err)
+	}
+	if len(members) != 1 || members[0].Peer != "keeper" {
+		t.Fatalf("expected only keeper to stay claimed, got %+v", members)
+	}
+}
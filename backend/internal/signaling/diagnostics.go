@@ -0,0 +1,343 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxTrackedPairs bounds the peer pairs remembered per room. The least
+// recently active pair is forgotten first.
+const maxTrackedPairs = 256
+
+// CandidateTally counts the ICE candidates one peer sent to another.
+type CandidateTally struct {
+	Total     int            `json:"total"`
+	Types     map[string]int `json:"types"`
+	Protocols map[string]int `json:"protocols"`
+	Families  map[string]int `json:"families"`
+	// EndOfCandidates is set once the peer signalled that gathering finished.
+	EndOfCandidates bool `json:"endOfCandidates"`
+}
+
+func newCandidateTally() *CandidateTally {
+	return &CandidateTally{
+		Types:     make(map[string]int),
+		Protocols: make(map[string]int),
+		Families:  make(map[string]int),
+	}
+}
+
+func (t *CandidateTally) add(c *iceCandidateLine) {
+	t.Total++
+	t.Types[c.typ]++
+	t.Protocols[c.protocol]++
+	if family := c.family(); family != "" {
+		t.Families[family]++
+	}
+}
+
+// onlyHost reports whether every candidate counted was a host candidate.
+func (t *CandidateTally) onlyHost() bool {
+	return t.Total > 0 && t.Types[candidateHost] == t.Total
+}
+
+// PairReport describes the signaling observed between two peers.
+type PairReport struct {
+	Peers      [2]string `json:"peers"`
+	OfferSeen  bool      `json:"offerSeen"`
+	AnswerSeen bool      `json:"answerSeen"`
+	// Candidates is keyed by the peer that sent them.
+	Candidates map[string]*CandidateTally `json:"candidates"`
+	FirstSeen  time.Time                  `json:"firstSeen"`
+	LastSeen   time.Time                  `json:"lastSeen"`
+	// Warnings are likely reasons the pair failed to connect.
+	Warnings []string `json:"warnings"`
+}
+
+// ICEReport lists the peer pairs of a room, most recently active first.
+type ICEReport struct {
+	Room        string       `json:"room"`
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Pairs       []PairReport `json:"pairs"`
+}
+
+// pairKey identifies an unordered pair of peers; a sorts before b.
+type pairKey struct {
+	a, b string
+}
+
+func newPairKey(x, y string) pairKey {
+	if y < x {
+		x, y = y, x
+	}
+	return pairKey{a: x, b: y}
+}
+
+// pairState is what the tracker remembers about one pair.
+type pairState struct {
+	key        pairKey
+	offerSeen  bool
+	answerSeen bool
+	candidates map[string]*CandidateTally
+	firstSeen  time.Time
+	lastSeen   time.Time
+	// handshake is the current offer/answer exchange; it restarts after one
+	// of the peers left.
+	handshake *handshake
+}
+
+// pairTracker records the offer/answer and ICE traffic between peer pairs
+// of one room.
+type pairTracker struct {
+	mu    sync.Mutex
+	pairs map[pairKey]*pairState
+	// joined holds the join time of the present peers.
+	joined  map[string]time.Time
+	timings *handshakeStats
+}
+
+func newPairTracker() *pairTracker {
+	return &pairTracker{
+		pairs:   make(map[pairKey]*pairState),
+		joined:  make(map[string]time.Time),
+		timings: newHandshakeStats(),
+	}
+}
+
+// join notes when a peer joined, the earliest moment a handshake with it
+// can start.
+func (t *pairTracker) join(peerID string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.joined[peerID] = now
+}
+
+// leave finishes the handshakes of a departing peer and returns the phases
+// that were completed by it.
+func (t *pairTracker) leave(peerID string) []handshakeSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.joined, peerID)
+	var samples []handshakeSample
+	for key, state := range t.pairs {
+		if (key.a != peerID && key.b != peerID) || state.handshake == nil {
+			continue
+		}
+		samples = append(samples, state.handshake.finish(key)...)
+		state.handshake = nil
+	}
+	return samples
+}
+
+// observe records a message routed from one peer to another and returns the
+// handshake phases it completed.
+func (t *pairTracker) observe(from, to string, msg Message, now time.Time) []handshakeSample {
+	var candidates []*iceCandidateLine
+	endOfCandidates := false
+
+	switch msg.Type {
+	case "ice":
+		var ice struct {
+			Candidate string `json:"candidate"`
+		}
+		if err := json.Unmarshal(msg.Payload, &ice); err != nil {
+			return nil
+		}
+		if ice.Candidate == "" {
+			endOfCandidates = true
+		} else if c, ok := parseCandidate(ice.Candidate); ok {
+			candidates = append(candidates, c)
+		}
+	case "offer", "answer":
+		var desc struct {
+			SDP string `json:"sdp"`
+		}
+		if err := json.Unmarshal(msg.Payload, &desc); err != nil {
+			return nil
+		}
+		for _, m := range parseSDP(desc.SDP).media {
+			for _, line := range m.lines {
+				if line == "a=end-of-candidates" {
+					endOfCandidates = true
+				} else if c, ok := parseCandidate(line); ok {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	default:
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.stateLocked(from, to, now)
+	switch msg.Type {
+	case "offer":
+		state.offerSeen = true
+	case "answer":
+		state.answerSeen = true
+	}
+
+	tally, ok := state.candidates[from]
+	if !ok {
+		tally = newCandidateTally()
+		state.candidates[from] = tally
+	}
+	for _, c := range candidates {
+		tally.add(c)
+	}
+	tally.EndOfCandidates = tally.EndOfCandidates || endOfCandidates
+
+	if state.handshake == nil {
+		state.handshake = &handshake{start: t.startLocked(state.key), ended: make(map[string]bool)}
+	}
+	return state.handshake.observe(state.key, from, msg.Type, len(candidates), endOfCandidates, now)
+}
+
+// startLocked returns the later join time of the pair, or zero when either
+// peer is not present.
+func (t *pairTracker) startLocked(key pairKey) time.Time {
+	a, okA := t.joined[key.a]
+	b, okB := t.joined[key.b]
+	if !okA || !okB {
+		return time.Time{}
+	}
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// stateLocked returns the state of the pair, creating it and evicting the
+// least recently active pair when the tracker is full.
+func (t *pairTracker) stateLocked(from, to string, now time.Time) *pairState {
+	key := newPairKey(from, to)
+	state, ok := t.pairs[key]
+	if !ok {
+		if len(t.pairs) >= maxTrackedPairs {
+			var oldest *pairState
+			for _, candidate := range t.pairs {
+				if oldest == nil || candidate.lastSeen.Before(oldest.lastSeen) {
+					oldest = candidate
+				}
+			}
+			delete(t.pairs, oldest.key)
+		}
+		state = &pairState{key: key, candidates: make(map[string]*CandidateTally), firstSeen: now}
+		t.pairs[key] = state
+	}
+	state.lastSeen = now
+	return state
+}
+
+// report snapshots the tracked pairs.
+func (t *pairTracker) report(roomID string, now time.Time) ICEReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := ICEReport{Room: roomID, GeneratedAt: now, Pairs: make([]PairReport, 0, len(t.pairs))}
+	for _, state := range t.pairs {
+		pair := PairReport{
+			Peers:      [2]string{state.key.a, state.key.b},
+			OfferSeen:  state.offerSeen,
+			AnswerSeen: state.answerSeen,
+			Candidates: make(map[string]*CandidateTally, 2),
+			FirstSeen:  state.firstSeen,
+			LastSeen:   state.lastSeen,
+		}
+		for _, peer := range pair.Peers {
+			tally := newCandidateTally()
+			if recorded, ok := state.candidates[peer]; ok {
+				*tally = *recorded
+				tally.Types = copyCounts(recorded.Types)
+				tally.Protocols = copyCounts(recorded.Protocols)
+				tally.Families = copyCounts(recorded.Families)
+			}
+			pair.Candidates[peer] = tally
+		}
+		pair.Warnings = pairWarnings(pair)
+		report.Pairs = append(report.Pairs, pair)
+	}
+
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		return report.Pairs[i].LastSeen.After(report.Pairs[j].LastSeen)
+	})
+	return report
+}
+
+func copyCounts(src map[string]int) map[string]int {
+	dst := make(map[string]int, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// pairWarnings points out the usual reasons a pair fails to connect.
+func pairWarnings(pair PairReport) []string {
+	warnings := []string{}
+	if pair.OfferSeen && !pair.AnswerSeen {
+		warnings = append(warnings, "offer was never answered")
+	}
+
+	a, b := pair.Candidates[pair.Peers[0]], pair.Candidates[pair.Peers[1]]
+	for _, peer := range pair.Peers {
+		if pair.Candidates[peer].Total == 0 {
+			warnings = append(warnings, fmt.Sprintf("no candidates from %s", peer))
+		}
+	}
+
+	switch {
+	case a.onlyHost() && b.onlyHost():
+		warnings = append(warnings, "both sides only had host candidates")
+	case a.onlyHost():
+		warnings = append(warnings, fmt.Sprintf("%s only had host candidates", pair.Peers[0]))
+	case b.onlyHost():
+		warnings = append(warnings, fmt.Sprintf("%s only had host candidates", pair.Peers[1]))
+	}
+
+	if a.Total > 0 && b.Total > 0 {
+		if !sharesKey(a.Protocols, b.Protocols) {
+			warnings = append(warnings, "no common transport protocol")
+		}
+		if !sharesFamily(a.Families, b.Families) {
+			warnings = append(warnings, "no common address family")
+		}
+	}
+	return warnings
+}
+
+func sharesKey(a, b map[string]int) bool {
+	for key := range a {
+		if _, ok := b[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sharesFamily treats mDNS names as compatible with any family, since they
+// resolve to an address the browser picks.
+func sharesFamily(a, b map[string]int) bool {
+	if a["mdns"] > 0 || b["mdns"] > 0 || len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	return sharesKey(a, b)
+}
+
+// ICEReport returns the ICE diagnostics of a room. It reports false when
+// diagnostics are disabled or the room does not exist.
+func (h *Hub) ICEReport(roomID string) (ICEReport, bool) {
+	h.mu.Lock()
+	r, ok := h.rooms[roomID]
+	h.mu.Unlock()
+	if !ok || r.pairs == nil {
+		return ICEReport{}, false
+	}
+	return r.pairs.report(roomID, time.Now()), true
+}
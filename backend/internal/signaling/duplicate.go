@@ -0,0 +1,79 @@
+package signaling
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// DuplicatePeerPolicy selects what happens when a peer joins with an ID that
+// is already taken in the room.
+type DuplicatePeerPolicy string
+
+const (
+	// DuplicateReject closes the newcomer with a policy violation.
+	DuplicateReject DuplicatePeerPolicy = "reject"
+	// DuplicateReplace closes the existing connection with CloseReplaced and
+	// admits the newcomer under the same ID.
+	DuplicateReplace DuplicatePeerPolicy = "replace"
+	// DuplicateSuffix admits the newcomer under a server-chosen unique ID.
+	DuplicateSuffix DuplicatePeerPolicy = "suffix"
+)
+
+const peerSuffixLength = 4
+
+// ParseDuplicatePeerPolicy converts a configuration value into a policy.
+func ParseDuplicatePeerPolicy(raw string) (DuplicatePeerPolicy, bool) {
+	switch policy := DuplicatePeerPolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case DuplicateReject, DuplicateReplace, DuplicateSuffix:
+		return policy, true
+	default:
+		return "", false
+	}
+}
+
+// DuplicatePeerConfig selects the duplicate-peer policy per role.
+type DuplicatePeerConfig struct {
+	// Default applies to roles without an entry in PerRole. Defaults to
+	// DuplicateReject.
+	Default DuplicatePeerPolicy
+	PerRole map[Role]DuplicatePeerPolicy
+}
+
+func (cfg DuplicatePeerConfig) policyFor(role Role) DuplicatePeerPolicy {
+	if policy, ok := cfg.PerRole[role]; ok && policy != "" {
+		return policy
+	}
+	if cfg.Default != "" {
+		return cfg.Default
+	}
+	return DuplicateReject
+}
+
+const peerIDAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// randomPeerSuffix returns n characters from an alphabet without look-alike
+// characters.
+func randomPeerSuffix(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic("signaling: failed to read random bytes: " + err.Error())
+	}
+	for i, b := range buf {
+		buf[i] = peerIDAlphabet[int(b)%len(peerIDAlphabet)]
+	}
+	return string(buf)
+}
+
+// uniquePeerID returns prefix followed by a random suffix that is not used by
+// any connected, detached or remote peer.
+func (r *room) uniquePeerID(prefix string) string {
+	for {
+		id := prefix + "-" + randomPeerSuffix(peerSuffixLength)
+		_, connected := r.clients[id]
+		_, detached := r.detached[id]
+		_, remote := r.remote[id]
+		if !connected && !detached && !remote {
+			return id
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package signaling
+
+import "fmt"
+
+// ErrorCode is the stable, machine-readable reason carried in ErrorPayload.
+// Clients should branch on the code; the accompanying message is for humans.
+type ErrorCode string
+
+const (
+	CodeUnsupportedFrame  ErrorCode = "unsupported_frame"
+	CodeInvalidMessage    ErrorCode = "invalid_message"
+	CodeMissingType       ErrorCode = "missing_type"
+	CodeRateLimited       ErrorCode = "rate_limited"
+	CodeEncodeFailed      ErrorCode = "encode_failed"
+	CodeRoomClosed        ErrorCode = "room_closed"
+	CodeTargetNotFound    ErrorCode = "target_not_found"
+	CodeTargetNotAllowed  ErrorCode = "target_not_allowed"
+	CodeDeliveryFailed    ErrorCode = "delivery_failed"
+	CodeMailboxExpired    ErrorCode = "mailbox_expired"
+	CodeRetainLimit       ErrorCode = "retain_limit"
+	CodeRecipientsMissing ErrorCode = "recipients_missing"
+	CodeInvalidPayload    ErrorCode = "invalid_payload"
+	CodeMessageTooLarge   ErrorCode = "message_too_large"
+	CodePolicyViolation   ErrorCode = "policy_violation"
+)
+
+// newError builds an error that is not tied to a particular inbound message.
+func newError(code ErrorCode, text string) ErrorPayload {
+	return ErrorPayload{Code: code, Message: text}
+}
+
+// messageError builds an error about msg, echoing its ID as the reference and
+// its type and target as details.
+func messageError(code ErrorCode, text string, msg Message) ErrorPayload {
+	return ErrorPayload{
+		Code:    code,
+		Message: text,
+		Ref:     msg.ID,
+		Details: &ErrorDetails{Type: msg.Type, To: msg.To},
+	}
+}
+
+// deliveryFailedError reports a frame from the sender that never reached peerID.
+func deliveryFailedError(peerID string, item outbound) ErrorPayload {
+	return ErrorPayload{
+		Code:    CodeDeliveryFailed,
+		Message: fmt.Sprintf("delivery to peer %q failed", peerID),
+		Ref:     item.id,
+		Details: &ErrorDetails{Type: item.msgType, To: Recipients{peerID}},
+	}
+}
@@ -8,16 +8,21 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/metrics"
 )
 
 const (
-	roomQueryParam = "room"
-	peerQueryParam = "peer"
+	roomQueryParam   = "room"
+	peerQueryParam   = "peer"
+	roleQueryParam   = "role"
+	tokenQueryParam  = "token"
+	resumeQueryParam = "resume"
 
 	closeGracePeriod = 2 * time.Second
 )
 
-func newUpgrader(policy originPolicy, logger *slog.Logger) websocket.Upgrader {
+func newUpgrader(policy originPolicy, rejected *metrics.Counter, logger *slog.Logger) websocket.Upgrader {
 	return websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header.Get("Origin")
@@ -25,6 +30,7 @@ func newUpgrader(policy originPolicy, logger *slog.Logger) websocket.Upgrader {
 				return true
 			}
 			logger.Warn("rejecting websocket origin", "origin", origin, "remote", r.RemoteAddr)
+			rejected.Inc()
 			return false
 		},
 	}
@@ -40,30 +46,75 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	roomID := strings.TrimSpace(r.URL.Query().Get(roomQueryParam))
-	peerID := strings.TrimSpace(r.URL.Query().Get(peerQueryParam))
+	query := r.URL.Query()
+	roomID := strings.TrimSpace(query.Get(roomQueryParam))
+	peerID := strings.TrimSpace(query.Get(peerQueryParam))
+	rawRole := strings.TrimSpace(query.Get(roleQueryParam))
+
+	var expiresAt time.Time
+	if len(h.tokenSecret) > 0 {
+		claims, err := ParseToken(h.tokenSecret, strings.TrimSpace(query.Get(tokenQueryParam)), time.Now())
+		if err != nil {
+			h.logger.WarnContext(ctx, "websocket request rejected: invalid token", "room", roomID, "peer", peerID, "remote", r.RemoteAddr, "err", err)
+			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+			return
+		}
 
-	if roomID == "" || peerID == "" {
+		boundRoom, boundPeer, boundRole, err := claims.bind(roomID, peerID, rawRole)
+		if err != nil {
+			h.logger.WarnContext(ctx, "websocket request rejected: token mismatch", "room", roomID, "peer", peerID, "remote", r.RemoteAddr, "err", err)
+			http.Error(w, "token does not match request", http.StatusForbidden)
+			return
+		}
+		roomID, peerID, rawRole = boundRoom, boundPeer, boundRole
+		expiresAt = claims.Expiry()
+	}
+
+	if roomID == "" || (peerID == "" && !h.assignPeerIDs) {
 		h.logger.WarnContext(ctx, "websocket request rejected: missing parameters", "room", roomID, "peer", peerID, "remote", r.RemoteAddr)
 		http.Error(w, "missing room or peer query parameter", http.StatusBadRequest)
 		return
 	}
 
+	if peerID == serverPeerID || isSelector(peerID) {
+		h.logger.WarnContext(ctx, "websocket request rejected: reserved peer id", "room", roomID, "peer", peerID, "remote", r.RemoteAddr)
+		http.Error(w, "peer id is reserved", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := parseRole(rawRole)
+	if !ok {
+		h.logger.WarnContext(ctx, "websocket request rejected: invalid role", "room", roomID, "peer", peerID, "role", rawRole, "remote", r.RemoteAddr)
+		http.Error(w, "invalid role query parameter", http.StatusBadRequest)
+		return
+	}
+
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		h.logger.ErrorContext(ctx, "failed to accept websocket", "err", err, "room", roomID, "peer", peerID, "remote", r.RemoteAddr)
 		return
 	}
 
-	client := newClient(h, roomID, peerID, conn)
+	client := newClient(h, roomID, peerID, role, conn)
+	client.remoteAddr = r.RemoteAddr
+	client.expiresAt = expiresAt
+	client.resumeRequest = strings.TrimSpace(query.Get(resumeQueryParam))
 
 	if err := h.register(ctx, client); err != nil {
+		h.metrics.registerFailures.With(registerFailureReason(err)).Inc()
 		var closeCode int
 		var reason string
-		if errors.Is(err, errPeerExists) {
+		switch {
+		case errors.Is(err, errPeerExists):
 			closeCode = websocket.ClosePolicyViolation
 			reason = "peer already registered"
-		} else {
+		case errors.Is(err, errBroadcasterExists):
+			closeCode = websocket.ClosePolicyViolation
+			reason = "broadcaster already present"
+		case errors.Is(err, errRejoinBlocked):
+			closeCode = websocket.ClosePolicyViolation
+			reason = "removed by operator"
+		default:
 			closeCode = websocket.CloseInternalServerErr
 			reason = "failed to join room"
 		}
@@ -78,7 +129,7 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.logger.InfoContext(ctx, "websocket client registered", "room", roomID, "peer", peerID, "remote", r.RemoteAddr)
+	h.logger.InfoContext(ctx, "websocket client registered", "room", roomID, "peer", client.peerID, "role", role, "remote", r.RemoteAddr)
 	client.run(ctx)
-	h.logger.InfoContext(ctx, "websocket client disconnected", "room", roomID, "peer", peerID)
+	h.logger.InfoContext(ctx, "websocket client disconnected", "room", roomID, "peer", client.peerID)
 }
@@ -0,0 +1,240 @@
+package signaling
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Handshake phases timed for each peer pair.
+const (
+	// PhaseJoinToOffer runs from the later join of the pair to the first offer.
+	PhaseJoinToOffer = "joinToOffer"
+	// PhaseOfferToAnswer runs from the first offer to the first answer.
+	PhaseOfferToAnswer = "offerToAnswer"
+	// PhaseAnswerToLastCandidate runs from the answer to the last candidate
+	// of either side. It is measured once both sides signalled the end of
+	// candidates or one of them left.
+	PhaseAnswerToLastCandidate = "answerToLastCandidate"
+)
+
+const (
+	// maxPhaseSamples bounds the samples summarized per phase; older samples
+	// are overwritten.
+	maxPhaseSamples = 1024
+	// DefaultSlowHandshake is the phase duration above which a handshake is
+	// logged as slow.
+	DefaultSlowHandshake = 5 * time.Second
+)
+
+// handshake is the timeline of one offer/answer exchange between a pair.
+type handshake struct {
+	start           time.Time
+	offerAt         time.Time
+	answerAt        time.Time
+	lastCandidateAt time.Time
+	// ended holds the peers that signalled the end of candidates.
+	ended map[string]bool
+	done  bool
+}
+
+// handshakeSample is a measured phase of one pair.
+type handshakeSample struct {
+	pair     pairKey
+	phase    string
+	duration time.Duration
+}
+
+// observe advances the timeline with a message and returns the phases it
+// completed.
+func (hs *handshake) observe(key pairKey, from, msgType string, candidates int, endOfCandidates bool, now time.Time) []handshakeSample {
+	if hs.done {
+		return nil
+	}
+
+	var samples []handshakeSample
+	switch msgType {
+	case "offer":
+		if hs.offerAt.IsZero() {
+			hs.offerAt = now
+			if !hs.start.IsZero() {
+				samples = append(samples, handshakeSample{pair: key, phase: PhaseJoinToOffer, duration: now.Sub(hs.start)})
+			}
+		}
+	case "answer":
+		if !hs.offerAt.IsZero() && hs.answerAt.IsZero() {
+			hs.answerAt = now
+			samples = append(samples, handshakeSample{pair: key, phase: PhaseOfferToAnswer, duration: now.Sub(hs.offerAt)})
+		}
+	}
+
+	if candidates > 0 {
+		hs.lastCandidateAt = now
+	}
+	if endOfCandidates {
+		hs.ended[from] = true
+	}
+	if hs.ended[key.a] && hs.ended[key.b] {
+		samples = append(samples, hs.finish(key)...)
+	}
+	return samples
+}
+
+// finish ends the timeline, measuring the answer-to-last-candidate phase if
+// an answer was seen.
+func (hs *handshake) finish(key pairKey) []handshakeSample {
+	if hs.done || hs.answerAt.IsZero() {
+		hs.done = true
+		return nil
+	}
+	hs.done = true
+
+	var d time.Duration
+	if hs.lastCandidateAt.After(hs.answerAt) {
+		d = hs.lastCandidateAt.Sub(hs.answerAt)
+	}
+	return []handshakeSample{{pair: key, phase: PhaseAnswerToLastCandidate, duration: d}}
+}
+
+// PhaseSummary summarizes the recent durations of one handshake phase in
+// milliseconds.
+type PhaseSummary struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50Ms"`
+	P90Ms float64 `json:"p90Ms"`
+	P99Ms float64 `json:"p99Ms"`
+	MaxMs float64 `json:"maxMs"`
+}
+
+// HandshakeReport summarizes handshake timings of a room, or of every room
+// when Room is empty.
+type HandshakeReport struct {
+	Room        string                  `json:"room,omitempty"`
+	GeneratedAt time.Time               `json:"generatedAt"`
+	Phases      map[string]PhaseSummary `json:"phases"`
+}
+
+// handshakeStats keeps the latest samples of each phase.
+type handshakeStats struct {
+	mu     sync.Mutex
+	phases map[string]*durationWindow
+}
+
+func newHandshakeStats() *handshakeStats {
+	return &handshakeStats{phases: make(map[string]*durationWindow)}
+}
+
+func (s *handshakeStats) record(phase string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.phases[phase]
+	if !ok {
+		w = &durationWindow{}
+		s.phases[phase] = w
+	}
+	w.add(d)
+}
+
+func (s *handshakeStats) report(roomID string, now time.Time) HandshakeReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := HandshakeReport{Room: roomID, GeneratedAt: now, Phases: make(map[string]PhaseSummary)}
+	for _, phase := range []string{PhaseJoinToOffer, PhaseOfferToAnswer, PhaseAnswerToLastCandidate} {
+		var summary PhaseSummary
+		if w, ok := s.phases[phase]; ok {
+			summary = w.summary()
+		}
+		report.Phases[phase] = summary
+	}
+	return report
+}
+
+// durationWindow is a ring of the latest maxPhaseSamples durations.
+type durationWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *durationWindow) add(d time.Duration) {
+	if len(w.samples) < maxPhaseSamples {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % maxPhaseSamples
+}
+
+// summary computes nearest-rank percentiles of the window.
+func (w *durationWindow) summary() PhaseSummary {
+	if len(w.samples) == 0 {
+		return PhaseSummary{}
+	}
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		return milliseconds(sorted[rank-1])
+	}
+	return PhaseSummary{
+		Count: len(sorted),
+		P50Ms: percentile(50),
+		P90Ms: percentile(90),
+		P99Ms: percentile(99),
+		MaxMs: milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// recordHandshakes adds samples to the room and hub statistics and logs the
+// phases slower than the configured threshold.
+func (r *room) recordHandshakes(samples []handshakeSample) {
+	for _, s := range samples {
+		r.pairs.timings.record(s.phase, s.duration)
+		r.hub.handshakes.record(s.phase, s.duration)
+		if threshold := r.hub.slowHandshake; threshold > 0 && s.duration > threshold {
+			r.logger.Warn("slow handshake", "peers", []string{s.pair.a, s.pair.b}, "phase", s.phase, "duration", s.duration)
+		}
+	}
+}
+
+// trackJoin starts the handshake clock of peerID's pairs.
+func (r *room) trackJoin(peerID string) {
+	if r.pairs != nil {
+		r.pairs.join(peerID, time.Now())
+	}
+}
+
+// trackLeave finishes the handshakes of a departing peer.
+func (r *room) trackLeave(peerID string) {
+	if r.pairs != nil {
+		r.recordHandshakes(r.pairs.leave(peerID))
+	}
+}
+
+// HandshakeReport returns the handshake timings of a room. It reports false
+// when diagnostics are disabled or the room does not exist.
+func (h *Hub) HandshakeReport(roomID string) (HandshakeReport, bool) {
+	h.mu.Lock()
+	r, ok := h.rooms[roomID]
+	h.mu.Unlock()
+	if !ok || r.pairs == nil {
+		return HandshakeReport{}, false
+	}
+	return r.pairs.timings.report(roomID, time.Now()), true
+}
+
+// GlobalHandshakeReport returns the handshake timings of every room, including
+// rooms that have since closed. It reports false when diagnostics are disabled.
+func (h *Hub) GlobalHandshakeReport() (HandshakeReport, bool) {
+	if h.handshakes == nil {
+		return HandshakeReport{}, false
+	}
+	return h.handshakes.report("", time.Now()), true
+}
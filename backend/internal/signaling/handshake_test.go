@@ -0,0 +1,76 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationWindowPercentiles(t *testing.T) {
+	var w durationWindow
+	for i := 1; i <= 100; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+
+	got := w.summary()
+	want := PhaseSummary{Count: 100, P50Ms: 50, P90Ms: 90, P99Ms: 99, MaxMs: 100}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDurationWindowKeepsLatestSamples(t *testing.T) {
+	var w durationWindow
+	for i := 0; i < maxPhaseSamples; i++ {
+		w.add(time.Second)
+	}
+	w.add(time.Millisecond)
+
+	got := w.summary()
+	if got.Count != maxPhaseSamples {
+		t.Fatalf("expected %d samples, got %d", maxPhaseSamples, got.Count)
+	}
+	if got.P50Ms != 1000 || got.MaxMs != 1000 {
+		t.Fatalf("unexpected summary %+v", got)
+	}
+
+	for i := 0; i < maxPhaseSamples; i++ {
+		w.add(time.Millisecond)
+	}
+	if got := w.summary(); got.MaxMs != 1 {
+		t.Fatalf("expected old samples to be overwritten, got %+v", got)
+	}
+}
+
+func TestHandshakeMeasuresPhases(t *testing.T) {
+	key := newPairKey("alice", "bob")
+	start := time.Now()
+	hs := &handshake{start: start, ended: make(map[string]bool)}
+
+	var samples []handshakeSample
+	samples = append(samples, hs.observe(key, "alice", "offer", 1, false, start.Add(100*time.Millisecond))...)
+	samples = append(samples, hs.observe(key, "bob", "answer", 0, false, start.Add(300*time.Millisecond))...)
+	samples = append(samples, hs.observe(key, "bob", "ice", 1, false, start.Add(700*time.Millisecond))...)
+	samples = append(samples, hs.observe(key, "alice", "ice", 0, true, start.Add(800*time.Millisecond))...)
+	if len(samples) != 2 {
+		t.Fatalf("expected join and answer phases before the end of candidates, got %+v", samples)
+	}
+	samples = append(samples, hs.observe(key, "bob", "ice", 0, true, start.Add(900*time.Millisecond))...)
+
+	want := map[string]time.Duration{
+		PhaseJoinToOffer:           100 * time.Millisecond,
+		PhaseOfferToAnswer:         200 * time.Millisecond,
+		PhaseAnswerToLastCandidate: 400 * time.Millisecond,
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("expected %d samples, got %+v", len(want), samples)
+	}
+	for _, s := range samples {
+		if s.duration != want[s.phase] {
+			t.Fatalf("expected %s to take %v, got %v", s.phase, want[s.phase], s.duration)
+		}
+	}
+
+	if extra := hs.observe(key, "alice", "offer", 0, false, start.Add(time.Second)); len(extra) != 0 {
+		t.Fatalf("expected a finished handshake to ignore renegotiation, got %+v", extra)
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 var (
-	errPeerExists = errors.New("peer already registered")
+	errPeerExists        = errors.New("peer already registered")
+	errBroadcasterExists = errors.New("broadcaster already present")
+	errRejoinBlocked     = errors.New("rejoin blocked by operator")
 )
 
 var devAllowedOrigins = []string{
@@ -25,14 +29,79 @@ var devAllowedOrigins = []string{
 type HubConfig struct {
 	Logger         *slog.Logger
 	AllowedOrigins []string
+	// TokenSecret enables join token authentication when non-empty. Every
+	// connection must then present a token signed with this secret.
+	TokenSecret []byte
+	// RateLimit configures inbound flood protection. Disabled when empty.
+	RateLimit RateLimitConfig
+	// SlowConsumer configures what happens when a peer's send queue is full.
+	SlowConsumer SlowConsumerConfig
+	// Keepalive configures ping/pong liveness checks.
+	Keepalive KeepaliveConfig
+	// Resume enables session resumption after unexpected disconnects.
+	Resume ResumeConfig
+	// DuplicatePeer resolves joins with an already registered peer ID.
+	DuplicatePeer DuplicatePeerConfig
+	// AssignPeerIDs lets clients omit the peer ID; the hub then generates a
+	// unique one such as "viewer-k3f9" and reports it in the welcome message.
+	AssignPeerIDs bool
+	// Mailbox holds messages for peers that have not joined yet.
+	Mailbox MailboxConfig
+	// Schemas validates messages by type before routing. Defaults to
+	// DefaultSchemaRegistry.
+	Schemas *SchemaRegistry
+	// Policies selects the media policies enforced per room.
+	Policies PolicyConfig
+	// Diagnostics records the offer/answer and ICE candidates exchanged
+	// between peers for ICEReport, and the handshake timings for
+	// HandshakeReport.
+	Diagnostics bool
+	// SlowHandshake is the phase duration above which a handshake is logged
+	// as slow. Zero uses DefaultSlowHandshake; a negative value disables the
+	// log.
+	SlowHandshake time.Duration
+	// RejoinBlock is how long a peer removed by Kick, CloseRoom or
+	// TakeDownBroadcast cannot rejoin its room under the same peer ID. Zero
+	// uses DefaultRejoinBlock; a negative value disables the block.
+	RejoinBlock time.Duration
+	// Broker shares rooms with other hub instances. Nil keeps every room
+	// local to this hub.
+	Broker Broker
+	// NodeID identifies this hub to the broker. Defaults to NewNodeID.
+	NodeID string
 }
 
 // Hub manages signaling rooms and routes messages between peers.
 type Hub struct {
-	mu       sync.Mutex
-	rooms    map[string]*room
-	logger   *slog.Logger
-	upgrader websocket.Upgrader
+	// mu guards rooms. It is only taken to look up, create or delete a room.
+	mu          sync.Mutex
+	rooms       map[string]*room
+	logger      *slog.Logger
+	upgrader    websocket.Upgrader
+	tokenSecret []byte
+	rateLimit   RateLimitConfig
+
+	slowConsumer  SlowConsumerConfig
+	keepalive     KeepaliveConfig
+	resume        ResumeConfig
+	duplicatePeer DuplicatePeerConfig
+	assignPeerIDs bool
+	mailbox       MailboxConfig
+	schemas       *SchemaRegistry
+	policies      PolicyConfig
+	diagnostics   bool
+	slowHandshake time.Duration
+	// handshakes aggregates the handshake timings of every room; nil unless
+	// diagnostics are enabled.
+	handshakes *handshakeStats
+	broker     Broker
+	node       string
+	// dropped counts frames that were not delivered because of full queues.
+	dropped atomic.Uint64
+	metrics *hubMetrics
+	// blocks holds the peers removed by an operator for rejoinBlock.
+	rejoinBlock time.Duration
+	blocks      rejoinBlocks
 }
 
 // NewHub constructs a Hub. If no logger is provided, slog.Default is used.
@@ -42,155 +111,258 @@ func NewHub(cfg HubConfig) *Hub {
 		logger = slog.Default()
 	}
 
+	schemas := cfg.Schemas
+	if schemas == nil {
+		schemas = DefaultSchemaRegistry()
+	}
+
+	slowHandshake := cfg.SlowHandshake
+	if slowHandshake == 0 {
+		slowHandshake = DefaultSlowHandshake
+	}
+	var handshakes *handshakeStats
+	if cfg.Diagnostics {
+		handshakes = newHandshakeStats()
+	}
+
+	rejoinBlock := cfg.RejoinBlock
+	if rejoinBlock == 0 {
+		rejoinBlock = DefaultRejoinBlock
+	}
+
+	node := cfg.NodeID
+	if node == "" {
+		node = NewNodeID()
+	}
+
 	baseLogger := logger.With("component", "signaling")
 	allowedOrigins := mergeAllowedOrigins(cfg.AllowedOrigins)
 	policy := newOriginPolicy(allowedOrigins)
 
-	return &Hub{
-		rooms:    make(map[string]*room),
-		logger:   baseLogger,
-		upgrader: newUpgrader(policy, baseLogger),
+	h := &Hub{
+		rooms:       make(map[string]*room),
+		logger:      baseLogger,
+		tokenSecret: cfg.TokenSecret,
+		rateLimit:   cfg.RateLimit,
+
+		slowConsumer:  cfg.SlowConsumer.withDefaults(),
+		keepalive:     cfg.Keepalive.withDefaults(),
+		resume:        cfg.Resume.withDefaults(),
+		duplicatePeer: cfg.DuplicatePeer,
+		assignPeerIDs: cfg.AssignPeerIDs,
+		mailbox:       cfg.Mailbox.withDefaults(),
+		schemas:       schemas,
+		policies:      cfg.Policies,
+		diagnostics:   cfg.Diagnostics,
+		slowHandshake: slowHandshake,
+		handshakes:    handshakes,
+		rejoinBlock:   rejoinBlock,
+		broker:        cfg.Broker,
+		node:          node,
 	}
+	h.metrics = newHubMetrics(h)
+	h.upgrader = newUpgrader(policy, h.metrics.rejectedOrigins, baseLogger)
+	return h
 }
 
 // register adds a client to the hub and creates the room if it does not exist.
+// The new client receives a welcome message with the current roster and the
+// other members of the room are notified with a peer-joined event.
 func (h *Hub) register(ctx context.Context, c *Client) error {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	r, ok := h.rooms[c.roomID]
-	if !ok {
-		r = newRoom(c.roomID, h.logger)
-		h.rooms[c.roomID] = r
+	if c.peerID != "" && h.blocks.blocked(c.roomID, c.peerID) {
+		return errRejoinBlocked
+	}
+	if h.resume.enabled() {
+		c.resumeToken = newResumeToken()
 	}
 
-	if err := r.addClient(c); err != nil {
-		h.logger.WarnContext(ctx, "failed to add client", "room", c.roomID, "peer", c.peerID, "err", err)
+	r, err := h.acquireRoom(ctx, c.roomID)
+	if err != nil {
+		h.logger.WarnContext(ctx, "failed to attach room to broker", "room", c.roomID, "peer", c.peerID, "err", err)
 		return err
 	}
+	c.room = r
 
-	h.logger.InfoContext(ctx, "peer joined", "room", c.roomID, "peer", c.peerID)
-	return nil
-}
-
-func (h *Hub) unregister(ctx context.Context, c *Client) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	r, ok := h.rooms[c.roomID]
-	if !ok {
-		return
+	// the room outlives the calls as c is counted as joining
+	claimed, err := r.claimJoin(ctx, c)
+	if err != nil {
+		h.logger.WarnContext(ctx, "failed to claim peer across nodes", "room", c.roomID, "peer", c.peerID, "err", err)
+		r.do(func() { r.joining.Add(-1) })
+		return err
 	}
 
-	r.removeClient(c.peerID)
-
-	if r.len() == 0 {
-		delete(h.rooms, c.roomID)
+	var result joinResult
+	r.call(func() {
+		r.joining.Add(-1)
+		result, err = r.addClient(c)
+		if err != nil || result.resumed {
+			return
+		}
+		if result.left != nil {
+			r.publishLeave(result.left.ID, result.left.Role, false)
+		}
+		r.publishJoin(c.peerID, c.role)
+	})
+	claimed(err != nil)
+	if err != nil {
+		h.logger.WarnContext(ctx, "failed to add client", "room", c.roomID, "peer", c.peerID, "err", err)
+		return err
 	}
 
-	h.logger.InfoContext(ctx, "peer left", "room", c.roomID, "peer", c.peerID)
-}
-
-func (h *Hub) dispatch(ctx context.Context, from *Client, msg Message) {
-	h.mu.Lock()
-	r, ok := h.rooms[from.roomID]
-	h.mu.Unlock()
-	h.logger.DebugContext(ctx, "dispatch message", "room", from.roomID, "from", from.peerID, "type", msg.Type, "to", msg.To)
-	if !ok {
-		from.sendError("room closed")
-		return
+	if result.replaced != nil {
+		reason := "replaced by a new connection"
+		if result.resumed {
+			reason = "session resumed elsewhere"
+		}
+		result.replaced.closeWithCode(CloseReplaced, reason)
 	}
 
-	msg.From = from.peerID
+	refuseMail(result.refused, c.peerID)
 
-	r.dispatch(ctx, from, msg)
-}
-
-// room keeps track of peers within the same logical signaling session.
-type room struct {
-	id      string
-	logger  *slog.Logger
-	mu      sync.RWMutex
-	clients map[string]*Client
-}
-
-func newRoom(id string, logger *slog.Logger) *room {
-	return &room{
-		id:      id,
-		logger:  logger.With("room", id),
-		clients: make(map[string]*Client),
+	if result.resumed {
+		h.logger.InfoContext(ctx, "peer resumed", "room", c.roomID, "peer", c.peerID, "role", c.role)
+		return nil
 	}
-}
-
-func (r *room) addClient(c *Client) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
 
-	if _, exists := r.clients[c.peerID]; exists {
-		return errPeerExists
+	if result.left != nil {
+		h.logger.InfoContext(ctx, "peer replaced", "room", c.roomID, "peer", result.left.ID, "role", result.left.Role)
+		abandon(result.abandoned, result.left.ID)
+		h.metrics.leaves.Inc()
+		r.trackLeave(result.left.ID)
 	}
 
-	r.clients[c.peerID] = c
+	h.logger.InfoContext(ctx, "peer joined", "room", c.roomID, "peer", c.peerID, "role", c.role)
+	h.metrics.joins.Inc()
+	r.trackJoin(c.peerID)
+	r.do(func() { r.announcePresence(c, result.left) })
 	return nil
 }
 
-func (r *room) removeClient(peerID string) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	delete(r.clients, peerID)
-}
+// announcePresence tells the clients c may reach that it joined, after the
+// departure of the session it replaced, if any. Nothing is sent if c already
+// left again.
+func (r *room) announcePresence(c *Client, left *PeerInfo) {
+	if r.clients[c.peerID] != c {
+		return
+	}
 
-func (r *room) len() int {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	others := make([]*Client, 0, len(r.clients))
+	for id, client := range r.clients {
+		if id != c.peerID && canReach(c.role, client.role) {
+			others = append(others, client)
+		}
+	}
+	if left != nil {
+		announceLeave(left.ID, left.Role, others)
+	}
 
-	return len(r.clients)
+	notice := newSystemMessage(typePeerJoined, PresencePayload{Peer: c.peerID, Role: c.role})
+	for _, other := range others {
+		other.enqueue(outbound{data: notice, msgType: typePeerJoined})
+	}
 }
 
-func (r *room) dispatch(ctx context.Context, from *Client, msg Message) {
-	payload, err := from.formatMessage(msg)
-	if err != nil {
-		from.sendError("failed to encode message")
+// unregister removes a client from its room and notifies the remaining peers.
+// A client whose socket dropped unexpectedly is detached instead and keeps its
+// slot for the resume grace period.
+func (h *Hub) unregister(ctx context.Context, c *Client) {
+	r := c.room
+	if r == nil {
 		return
 	}
 
-	if msg.To != "" {
-		target := r.getClient(msg.To)
-		if target == nil {
-			from.sendError("target peer not found")
+	var detached, removed bool
+	r.call(func() {
+		if h.resume.enabled() && c.detachable {
+			detached = r.detachClient(c, h.resume.Grace, func(d *detachedPeer) {
+				h.expireDetached(r, d)
+			})
 			return
 		}
 
-		target.enqueue(payload)
+		var remaining []*Client
+		remaining, removed = r.removeClient(c)
+		if removed {
+			announceLeave(c.peerID, c.role, remaining)
+			r.publishLeave(c.peerID, c.role, true)
+		}
+	})
+
+	if detached {
+		h.logger.InfoContext(ctx, "peer detached; holding slot", "room", c.roomID, "peer", c.peerID, "role", c.role, "grace", h.resume.Grace)
 		return
 	}
-
-	for _, client := range r.listExcept(from.peerID) {
-		client.enqueue(payload)
+	if !removed {
+		return
 	}
+
+	h.logger.InfoContext(ctx, "peer left", "room", c.roomID, "peer", c.peerID, "role", c.role)
+	abandon(c.queue.drain(), c.peerID)
+	h.metrics.leaves.Inc()
+	r.trackLeave(c.peerID)
 }
 
-func (r *room) getClient(peerID string) *Client {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// expireDetached releases the slot of a detached peer whose grace period
+// elapsed without a resume.
+func (h *Hub) expireDetached(r *room, d *detachedPeer) {
+	var expired bool
+	r.call(func() {
+		var remaining []*Client
+		remaining, expired = r.expireDetached(d)
+		if expired {
+			announceLeave(d.peerID, d.role, remaining)
+			r.publishLeave(d.peerID, d.role, true)
+		}
+	})
+	if !expired {
+		return
+	}
 
-	return r.clients[peerID]
+	h.logger.Info("peer left after resume grace expired", "room", r.id, "peer", d.peerID, "role", d.role, "buffered", len(d.buffer))
+	h.dropped.Add(uint64(len(d.buffer)))
+	abandon(d.buffer, d.peerID)
+	h.metrics.leaves.Inc()
+	r.trackLeave(d.peerID)
 }
 
-func (r *room) listExcept(peerID string) []*Client {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// announceLeave sends peer-left, and broadcaster-left for the broadcaster, to
+// the remaining clients that could reach the departed peer.
+func announceLeave(peerID string, role Role, remaining []*Client) {
+	presence := PresencePayload{Peer: peerID, Role: role}
+	notice := newSystemMessage(typePeerLeft, presence)
+	var broadcasterLeft []byte
+	if role == RoleBroadcaster {
+		broadcasterLeft = newSystemMessage(typeBroadcasterLeft, presence)
+	}
 
-	out := make([]*Client, 0, len(r.clients))
-	for id, client := range r.clients {
-		if id == peerID {
+	for _, other := range remaining {
+		if !canReach(role, other.role) {
 			continue
 		}
-		out = append(out, client)
+		other.enqueue(outbound{data: notice, msgType: typePeerLeft})
+		if broadcasterLeft != nil {
+			other.enqueue(outbound{data: broadcasterLeft, msgType: typeBroadcasterLeft})
+		}
 	}
+}
+
+// dispatch queues msg for the room of from. Messages of a room are routed one
+// at a time, in the order they reach its inbox.
+func (h *Hub) dispatch(ctx context.Context, from *Client, msg Message) {
+	h.logger.DebugContext(ctx, "dispatch message", "room", from.roomID, "from", from.peerID, "type", msg.Type, "to", msg.To)
+	msg.From = from.peerID
+
+	r := from.room
+	if r == nil || !r.route(ctx, from, msg) {
+		from.sendError(messageError(CodeRoomClosed, "room closed", msg))
+	}
+}
 
-	return out
+// inspects reports whether the hub looks into the payload of msgType, either
+// to validate it or because policies and diagnostics act on the WebRTC
+// handshake.
+func (h *Hub) inspects(msgType string) bool {
+	return isPriorityType(msgType) || h.schemas.has(msgType)
 }
 
 func mergeAllowedOrigins(configured []string) []string {
@@ -0,0 +1,260 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Candidate types as they appear after "typ" in an ICE candidate.
+const (
+	candidateHost  = "host"
+	candidateRelay = "relay"
+)
+
+// iceCandidateLine is a parsed ICE candidate attribute (RFC 8839):
+//
+//	candidate:<foundation> <component> <transport> <priority> <address> <port> typ <type> [<name> <value>]...
+type iceCandidateLine struct {
+	fields   []string
+	protocol string
+	address  string
+	typ      string
+}
+
+// parseCandidate parses a candidate with or without the "a=" prefix.
+func parseCandidate(raw string) (*iceCandidateLine, bool) {
+	raw = strings.TrimPrefix(raw, "a=")
+	if !strings.HasPrefix(raw, "candidate:") {
+		return nil, false
+	}
+	fields := strings.Fields(raw)
+	if len(fields) < 8 || fields[6] != "typ" {
+		return nil, false
+	}
+	return &iceCandidateLine{
+		fields:   fields,
+		protocol: strings.ToLower(fields[2]),
+		address:  fields[4],
+		typ:      strings.ToLower(fields[7]),
+	}, true
+}
+
+// String reassembles the candidate without the "a=" prefix.
+func (c *iceCandidateLine) String() string {
+	return strings.Join(c.fields, " ")
+}
+
+// mdns reports whether the address is an mDNS name hiding a host address.
+func (c *iceCandidateLine) mdns() bool {
+	return strings.HasSuffix(strings.ToLower(c.address), ".local")
+}
+
+// family returns "ipv4", "ipv6" or "mdns", or "" for an unparsable address.
+func (c *iceCandidateLine) family() string {
+	if c.mdns() {
+		return "mdns"
+	}
+	addr, err := netip.ParseAddr(c.address)
+	if err != nil {
+		return ""
+	}
+	if addr.Unmap().Is4() {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// hideRelatedAddress replaces a private raddr/rport with 0.0.0.0 and 0, as
+// browsers do for srflx candidates when they hide local addresses.
+func (c *iceCandidateLine) hideRelatedAddress() {
+	for i := 8; i+1 < len(c.fields); i += 2 {
+		if c.fields[i] == "raddr" && isPrivateAddress(c.fields[i+1]) {
+			c.fields[i+1] = "0.0.0.0"
+			if i+3 < len(c.fields) && c.fields[i+2] == "rport" {
+				c.fields[i+3] = "0"
+			}
+		}
+	}
+}
+
+// isPrivateAddress reports whether raw is a literal address that should not
+// leave the local network: private, loopback, link-local or unspecified.
+func isPrivateAddress(raw string) bool {
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
+
+// ICEPolicy filters the ICE candidates exchanged in a room, both in ice
+// messages and in candidates embedded in offer and answer SDP.
+type ICEPolicy struct {
+	// RelayOnly keeps only relay (TURN) candidates.
+	RelayOnly bool `json:"relayOnly,omitempty"`
+	// StripHost drops host candidates.
+	StripHost bool `json:"stripHost,omitempty"`
+	// StripPrivate drops candidates with private, loopback or link-local
+	// addresses and hides such related addresses of the remaining ones.
+	StripPrivate bool `json:"stripPrivate,omitempty"`
+	// StripMDNS drops candidates with mDNS ".local" addresses.
+	StripMDNS bool `json:"stripMDNS,omitempty"`
+	// Protocols lists the allowed transports, "udp" and/or "tcp". Empty
+	// allows both.
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+func (p *ICEPolicy) validate() error {
+	for _, proto := range p.Protocols {
+		if !strings.EqualFold(proto, "udp") && !strings.EqualFold(proto, "tcp") {
+			return fmt.Errorf("unknown protocol %q", proto)
+		}
+	}
+	return nil
+}
+
+// filter returns the candidate to forward, possibly rewritten, and whether
+// the candidate is allowed at all. Unparsable candidates are dropped.
+func (p *ICEPolicy) filter(raw string) (string, bool) {
+	c, ok := parseCandidate(raw)
+	if !ok {
+		return "", false
+	}
+	switch {
+	case p.RelayOnly && c.typ != candidateRelay:
+		return "", false
+	case p.StripHost && c.typ == candidateHost:
+		return "", false
+	case p.StripMDNS && c.mdns():
+		return "", false
+	case p.StripPrivate && isPrivateAddress(c.address):
+		return "", false
+	case len(p.Protocols) > 0 && !containsFold(p.Protocols, c.protocol):
+		return "", false
+	}
+
+	if p.StripPrivate {
+		c.hideRelatedAddress()
+	}
+	return c.String(), true
+}
+
+// filterSDP removes disallowed a=candidate lines. A connection address that
+// belonged to a removed candidate is replaced with the 0.0.0.0 placeholder
+// and port 9 used before candidates are gathered.
+func (p *ICEPolicy) filterSDP(sdp string) (string, int) {
+	desc := parseSDP(sdp)
+	dropped := 0
+	changed := false
+
+	for _, m := range desc.media {
+		removedAddrs := make(map[string]bool)
+		lines := m.lines[:0]
+		for _, line := range m.lines {
+			if !strings.HasPrefix(line, "a=candidate:") {
+				lines = append(lines, line)
+				continue
+			}
+			if filtered, ok := p.filter(line); ok {
+				changed = changed || "a="+filtered != line
+				lines = append(lines, "a="+filtered)
+				continue
+			}
+			dropped++
+			if c, ok := parseCandidate(line); ok {
+				removedAddrs[c.address] = true
+			}
+		}
+		m.lines = lines
+
+		for i, line := range m.lines {
+			fields := strings.Fields(strings.TrimPrefix(line, "c="))
+			if strings.HasPrefix(line, "c=") && len(fields) == 3 && removedAddrs[fields[2]] {
+				m.lines[i] = "c=IN IP4 0.0.0.0"
+				if m.port != "0" {
+					// a rejected section stays rejected
+					m.port = "9"
+				}
+			}
+		}
+	}
+
+	if dropped == 0 && !changed {
+		return sdp, 0
+	}
+	return desc.String(), dropped
+}
+
+// applyICEPolicy filters the candidate of an ice message and the candidates
+// embedded in offer and answer SDP. It reports false when the whole message
+// must be withheld.
+func (r *room) applyICEPolicy(from *Client, msg *Message) bool {
+	policy := r.policy.ICE
+	if policy == nil {
+		return true
+	}
+
+	switch msg.Type {
+	case "ice":
+		var fields map[string]json.RawMessage
+		var candidate string
+		if err := json.Unmarshal(msg.Payload, &fields); err != nil {
+			return true
+		}
+		if err := json.Unmarshal(fields["candidate"], &candidate); err != nil || candidate == "" {
+			return true
+		}
+
+		filtered, ok := policy.filter(candidate)
+		if !ok {
+			r.logger.Debug("ice candidate filtered", "peer", from.peerID, "candidate", candidate)
+			if msg.Ack {
+				for _, to := range r.recipientIDs(from, msg.To) {
+					acknowledge(outbound{from: from, id: msg.ID, ack: true}, to, AckFiltered)
+				}
+			}
+			return false
+		}
+		if filtered != candidate {
+			fields["candidate"], _ = json.Marshal(filtered)
+			msg.Payload, _ = json.Marshal(fields)
+		}
+		return true
+	case "offer", "answer":
+		var dropped int
+		payload, err := rewriteSDPField(msg.Payload, func(sdp string) string {
+			var out string
+			out, dropped = policy.filterSDP(sdp)
+			return out
+		})
+		if err != nil {
+			return true
+		}
+		if dropped > 0 {
+			r.logger.Debug("sdp candidates filtered", "peer", from.peerID, "type", msg.Type, "dropped", dropped)
+		}
+		msg.Payload = payload
+		return true
+	default:
+		return true
+	}
+}
+
+// recipientIDs returns the peers, local or on other nodes, that a message
+// from from addressed to to would reach, with selectors resolved.
+func (r *room) recipientIDs(from *Client, to Recipients) []string {
+	clients, detached, missing := r.resolve(from.peerID, from.role, to)
+	ids := detached
+	for _, c := range clients {
+		ids = append(ids, c.peerID)
+	}
+	for _, id := range missing {
+		if m, ok := r.remote[id]; ok && canReach(from.role, m.Role) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,72 @@
+package signaling
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testHostCandidate  = "candidate:1 1 udp 2122260223 192.168.1.10 54321 typ host generation 0"
+	testMDNSCandidate  = "candidate:2 1 udp 2122260223 4f6b1f2e-1234.local 54321 typ host"
+	testSrflxCandidate = "candidate:3 1 udp 1686052607 203.0.113.7 61000 typ srflx raddr 192.168.1.10 rport 54321"
+	testRelayCandidate = "candidate:4 1 udp 41885439 198.51.100.9 3478 typ relay raddr 203.0.113.7 rport 61000"
+	testTCPCandidate   = "candidate:5 1 tcp 1518280447 203.0.113.7 9 typ srflx tcptype active"
+)
+
+func TestICEPolicyFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  ICEPolicy
+		allowed []string
+	}{
+		{"relay only", ICEPolicy{RelayOnly: true}, []string{testRelayCandidate}},
+		{"strip host", ICEPolicy{StripHost: true}, []string{testSrflxCandidate, testRelayCandidate, testTCPCandidate}},
+		{"strip mdns", ICEPolicy{StripMDNS: true}, []string{testHostCandidate, testSrflxCandidate, testRelayCandidate, testTCPCandidate}},
+		{"strip private", ICEPolicy{StripPrivate: true}, []string{testMDNSCandidate, testSrflxCandidate, testRelayCandidate, testTCPCandidate}},
+		{"tcp only", ICEPolicy{Protocols: []string{"TCP"}}, []string{testTCPCandidate}},
+	}
+
+	all := []string{testHostCandidate, testMDNSCandidate, testSrflxCandidate, testRelayCandidate, testTCPCandidate}
+	for _, tc := range cases {
+		var got []string
+		for _, candidate := range all {
+			if _, ok := tc.policy.filter(candidate); ok {
+				got = append(got, candidate)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.allowed, "\n") {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.allowed, got)
+		}
+	}
+}
+
+func TestICEPolicyHidesPrivateRelatedAddress(t *testing.T) {
+	policy := ICEPolicy{StripPrivate: true}
+
+	filtered, ok := policy.filter(testSrflxCandidate)
+	if !ok || !strings.HasSuffix(filtered, "raddr 0.0.0.0 rport 0") {
+		t.Fatalf("expected private raddr to be hidden, got %q (ok=%v)", filtered, ok)
+	}
+}
+
+func TestICEPolicyFiltersSDPCandidates(t *testing.T) {
+	sdp := "v=0\r\n" +
+		"m=video 54321 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"c=IN IP4 192.168.1.10\r\n" +
+		"a=rtpmap:96 H264/90000\r\n" +
+		"a=" + testHostCandidate + "\r\n" +
+		"a=" + testRelayCandidate + "\r\n"
+
+	out, dropped := (&ICEPolicy{RelayOnly: true}).filterSDP(sdp)
+	if dropped != 1 {
+		t.Fatalf("expected one dropped candidate, got %d", dropped)
+	}
+	for _, want := range []string{"m=video 9 ", "c=IN IP4 0.0.0.0\r\n", "a=" + testRelayCandidate + "\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in filtered sdp:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "192.168.1.10") {
+		t.Fatalf("expected host address to be removed:\n%s", out)
+	}
+}
@@ -0,0 +1,98 @@
+package signaling
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultPingInterval = 25 * time.Second
+	defaultPongTimeout  = 10 * time.Second
+)
+
+// KeepaliveConfig controls WebSocket ping/pong liveness checks.
+type KeepaliveConfig struct {
+	// PingInterval is the time between pings. Defaults to 25 seconds; a
+	// negative value disables keepalive.
+	PingInterval time.Duration
+	// PongTimeout is how long a peer may stay silent after a ping is due
+	// before it is evicted. Defaults to 10 seconds.
+	PongTimeout time.Duration
+}
+
+func (cfg KeepaliveConfig) withDefaults() KeepaliveConfig {
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = defaultPingInterval
+	}
+	if cfg.PongTimeout <= 0 {
+		cfg.PongTimeout = defaultPongTimeout
+	}
+	return cfg
+}
+
+func (cfg KeepaliveConfig) enabled() bool {
+	return cfg.PingInterval > 0
+}
+
+// readDeadline is the deadline for the next frame from the peer.
+func (cfg KeepaliveConfig) readDeadline(now time.Time) time.Time {
+	return now.Add(cfg.PingInterval + cfg.PongTimeout)
+}
+
+// watch arms the read deadline of conn and pings it every PingInterval until
+// done is closed. Pongs push the deadline back; readers do the same after
+// each frame with extend. It is used by the broker connections, whose frames
+// need no round-trip times.
+func (cfg KeepaliveConfig) watch(conn *websocket.Conn, done <-chan struct{}) {
+	if !cfg.enabled() {
+		return
+	}
+	cfg.extend(conn)
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(cfg.readDeadline(time.Now()))
+	})
+
+	go func() {
+		ticker := time.NewTicker(cfg.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, now.Add(brokerWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// extend pushes the read deadline of conn back after a frame was read.
+func (cfg KeepaliveConfig) extend(conn *websocket.Conn) {
+	if cfg.enabled() {
+		_ = conn.SetReadDeadline(cfg.readDeadline(time.Now()))
+	}
+}
+
+// encodePing stores the send time in the ping payload so the pong echoes it.
+func encodePing(now time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(now.UnixNano()))
+	return buf
+}
+
+// decodePong returns the round-trip time for a pong echoing encodePing.
+func decodePong(appData string, now time.Time) (time.Duration, bool) {
+	if len(appData) != 8 {
+		return 0, false
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64([]byte(appData))))
+	rtt := now.Sub(sent)
+	if rtt < 0 {
+		return 0, false
+	}
+	return rtt, true
+}
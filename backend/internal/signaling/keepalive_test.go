@@ -0,0 +1,19 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodePongMeasuresRoundTrip(t *testing.T) {
+	sent := time.Unix(1700000000, 0)
+
+	rtt, ok := decodePong(string(encodePing(sent)), sent.Add(42*time.Millisecond))
+	if !ok || rtt != 42*time.Millisecond {
+		t.Fatalf("expected 42ms rtt, got %v (ok=%v)", rtt, ok)
+	}
+
+	if _, ok := decodePong("unexpected", sent); ok {
+		t.Fatalf("expected foreign pong payload to be ignored")
+	}
+}
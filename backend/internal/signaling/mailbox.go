@@ -0,0 +1,137 @@
+package signaling
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultMailboxSize = 64
+
+// MailboxConfig controls store-and-forward of messages addressed to peers
+// that are not in the room yet.
+type MailboxConfig struct {
+	// TTL is how long a message waits for its target to join. Zero disables
+	// the mailbox.
+	TTL time.Duration
+	// Size bounds the messages held per room. Defaults to 64.
+	Size int
+}
+
+func (cfg MailboxConfig) withDefaults() MailboxConfig {
+	if cfg.Size <= 0 {
+		cfg.Size = defaultMailboxSize
+	}
+	return cfg
+}
+
+func (cfg MailboxConfig) enabled() bool {
+	return cfg.TTL > 0
+}
+
+// mail is a frame waiting in a room mailbox for the peer it is addressed to.
+// It is owned by the room goroutine.
+type mail struct {
+	to    string
+	item  outbound
+	timer *time.Timer
+}
+
+// mailExpiredError reports a frame whose target did not join within the TTL.
+func mailExpiredError(m *mail) ErrorPayload {
+	return ErrorPayload{
+		Code:    CodeMailboxExpired,
+		Message: fmt.Sprintf("peer %q did not join in time", m.to),
+		Ref:     m.item.id,
+		Details: &ErrorDetails{Type: m.item.msgType, To: Recipients{m.to}},
+	}
+}
+
+// postIfEnabled posts item when the mailbox is enabled and reports whether it
+// was accepted.
+func (r *room) postIfEnabled(peerID string, item outbound) bool {
+	return r.hub.mailbox.enabled() && r.post(peerID, item)
+}
+
+// post delivers item to peerID if it joined in the meantime, and otherwise
+// stores it in the mailbox. It reports false when the mailbox is full.
+func (r *room) post(peerID string, item outbound) bool {
+	if target, ok := r.clients[peerID]; ok {
+		target.enqueue(item)
+		return true
+	}
+
+	cfg := r.hub.mailbox
+	if len(r.mailbox) >= cfg.Size {
+		return false
+	}
+
+	m := &mail{to: peerID, item: item}
+	m.timer = time.AfterFunc(cfg.TTL, func() {
+		r.do(func() { r.expireMail(m) })
+	})
+	r.mailbox = append(r.mailbox, m)
+	return true
+}
+
+// collectMail removes and returns, in arrival order, the frames waiting
+// for c, split into those c may receive and those it may not.
+func (r *room) collectMail(c *Client) (deliver, refused []outbound) {
+	kept := r.mailbox[:0]
+	for _, m := range r.mailbox {
+		if m.to != c.peerID {
+			kept = append(kept, m)
+			continue
+		}
+		m.timer.Stop()
+		if canReach(m.item.from.role, c.role) {
+			deliver = append(deliver, m.item)
+		} else {
+			refused = append(refused, m.item)
+		}
+	}
+	for i := len(kept); i < len(r.mailbox); i++ {
+		r.mailbox[i] = nil
+	}
+	r.mailbox = kept
+	return deliver, refused
+}
+
+// expireMail drops m if it is still waiting and tells its sender.
+func (r *room) expireMail(m *mail) {
+	found := false
+	for i, queued := range r.mailbox {
+		if queued == m {
+			r.mailbox = append(r.mailbox[:i], r.mailbox[i+1:]...)
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return
+	}
+
+	r.logger.Info("mailbox message expired", "peer", m.to, "type", m.item.msgType)
+	if m.item.ack {
+		acknowledge(m.item, m.to, AckTargetGone)
+		return
+	}
+	m.item.from.sendError(mailExpiredError(m))
+}
+
+// refuseMail tells the senders of frames held for peerID that its role turned
+// out to be unreachable for them.
+func refuseMail(items []outbound, peerID string) {
+	for _, item := range items {
+		if item.ack {
+			acknowledge(item, peerID, AckTargetGone)
+			continue
+		}
+		item.from.sendError(ErrorPayload{
+			Code:    CodeTargetNotAllowed,
+			Message: "target peer not allowed",
+			Ref:     item.id,
+			Details: &ErrorDetails{Type: item.msgType, To: Recipients{peerID}},
+		})
+	}
+}
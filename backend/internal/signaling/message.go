@@ -1,25 +1,213 @@
 package signaling
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// serverPeerID is stamped into the From field of messages emitted by the hub itself.
+const serverPeerID = "server"
+
+// System message types emitted by the hub.
+const (
+	typeWelcome    = "welcome"
+	typePeerJoined = "peer-joined"
+	typePeerLeft   = "peer-left"
+	typeError      = "error"
+	typeAck        = "ack"
+
+	typeBroadcasterLeft = "broadcaster-left"
+	typeRoomClosed      = "room-closed"
+	typeBroadcastEnded  = "broadcast-ended"
+)
 
 // Message represents the signaling payload exchanged between peers.
 type Message struct {
+	// ID is an optional client-chosen identifier echoed as Ref in errors.
+	ID      string          `json:"id,omitempty"`
 	Type    string          `json:"type"`
-	To      string          `json:"to,omitempty"`
+	To      Recipients      `json:"to,omitempty"`
 	From    string          `json:"from,omitempty"`
 	Payload json.RawMessage `json:"payload,omitempty"`
+	// Ack asks the hub to report the delivery status of a targeted message.
+	Ack bool `json:"ack,omitempty"`
+	// Retain keeps a broadcast message for peers that join later.
+	Retain bool `json:"retain,omitempty"`
+	// Seq is the per-room sequence number the hub assigns to routed messages.
+	Seq uint64 `json:"seq,omitempty"`
+	// TS is the time the hub received the message, in Unix milliseconds.
+	TS int64 `json:"ts,omitempty"`
+
+	// raw is the frame as received when its payload was not decoded. It is
+	// forwarded as is, with the fields the hub stamps appended.
+	raw []byte
+}
+
+// messageHeader is the part of a frame the hub routes by. From, Seq and TS
+// only record whether the client set fields the hub overrides.
+type messageHeader struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	To     Recipients      `json:"to"`
+	Ack    bool            `json:"ack"`
+	Retain bool            `json:"retain"`
+	From   json.RawMessage `json:"from"`
+	Seq    json.RawMessage `json:"seq"`
+	TS     json.RawMessage `json:"ts"`
+}
+
+// decodeMessage decodes a frame received from a peer. Only the routing
+// header is decoded unless inspect reports that the hub looks into the
+// payload of the message type, or the frame sets fields the hub overrides;
+// other frames keep their raw bytes so that they are never re-encoded.
+func decodeMessage(data []byte, inspect func(msgType string) bool) (Message, error) {
+	var header messageHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return Message{}, err
+	}
+
+	if header.Type == "" || inspect(header.Type) || header.From != nil || header.Seq != nil || header.TS != nil || header.Ack || !exactHeaderKeys(data) {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return Message{}, err
+		}
+		return msg, nil
+	}
+
+	return Message{
+		ID:     header.ID,
+		Type:   header.Type,
+		To:     header.To,
+		Retain: header.Retain,
+		raw:    data,
+	}, nil
+}
+
+// headerKeys are the JSON keys of messageHeader.
+var headerKeys = []string{"id", "type", "to", "ack", "retain", "from", "seq", "ts"}
+
+// exactHeaderKeys reports whether every top-level key of data that names a
+// header field does so in its exact case. encoding/json matches keys case
+// insensitively, so {"TYPE":"chat"} routes as chat, but a raw frame would
+// reach its recipients without a type key.
+func exactHeaderKeys(data []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return false
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		key, _ := tok.(string)
+		for _, name := range headerKeys {
+			if key != name && strings.EqualFold(key, name) {
+				return false
+			}
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// encode returns the frame delivered to the recipients of msg. A frame kept
+// raw is extended in place of being marshalled again.
+func (msg Message) encode() ([]byte, error) {
+	if msg.raw == nil {
+		return json.Marshal(msg)
+	}
+
+	end := bytes.LastIndexByte(msg.raw, '}')
+	from, err := json.Marshal(msg.From)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 0, end+len(from)+48)
+	frame = append(frame, msg.raw[:end]...)
+	frame = append(frame, `,"from":`...)
+	frame = append(frame, from...)
+	if msg.Seq != 0 {
+		frame = append(frame, `,"seq":`...)
+		frame = strconv.AppendUint(frame, msg.Seq, 10)
+	}
+	if msg.TS != 0 {
+		frame = append(frame, `,"ts":`...)
+		frame = strconv.AppendInt(frame, msg.TS, 10)
+	}
+	return append(frame, '}'), nil
 }
 
 // ErrorPayload is sent to the client when the hub rejects a message.
 type ErrorPayload struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Type    string    `json:"type"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Ref echoes the ID of the message that caused the error, if it had one.
+	Ref     string        `json:"ref,omitempty"`
+	Details *ErrorDetails `json:"details,omitempty"`
 }
 
-func newErrorPayload(msg string) []byte {
-	payload, _ := json.Marshal(ErrorPayload{
-		Type:    "error",
-		Message: msg,
-	})
+// ErrorDetails identifies the message an error refers to.
+type ErrorDetails struct {
+	Type string     `json:"type,omitempty"`
+	To   Recipients `json:"to,omitempty"`
+	// Missing lists the named recipients that were not found.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// PeerInfo describes a peer in a room roster.
+type PeerInfo struct {
+	ID   string `json:"id"`
+	Role Role   `json:"role"`
+}
+
+// WelcomePayload is sent to a client right after it joins a room.
+type WelcomePayload struct {
+	Peer  string     `json:"peer"`
+	Role  Role       `json:"role"`
+	Peers []PeerInfo `json:"peers"`
+	// ResumeToken lets the client reclaim its slot after a dropped socket.
+	ResumeToken string `json:"resumeToken,omitempty"`
+	// Resumed is set when the connection took over a held session.
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// PresencePayload describes the peer referenced by a presence event.
+type PresencePayload struct {
+	Peer string `json:"peer"`
+	Role Role   `json:"role"`
+}
+
+// NoticePayload carries an operator message sent with room-closed.
+type NoticePayload struct {
+	Message string `json:"message,omitempty"`
+}
+
+// BroadcastEndedPayload describes a broadcast an operator took down.
+type BroadcastEndedPayload struct {
+	Peer   string `json:"peer"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func newErrorPayload(e ErrorPayload) []byte {
+	e.Type = typeError
+	payload, _ := json.Marshal(e)
 	return payload
 }
+
+func newSystemMessage(msgType string, payload any) []byte {
+	raw, _ := json.Marshal(payload)
+	data, _ := json.Marshal(Message{
+		Type:    msgType,
+		From:    serverPeerID,
+		Payload: raw,
+	})
+	return data
+}
@@ -0,0 +1,95 @@
+package signaling
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeMessageKeepsUninspectedFramesRaw(t *testing.T) {
+	frame := []byte(`{"type":"chat","to":["role:viewer"],"payload":{"text":"hi","extra":[1,2]}} `)
+	msg, err := decodeMessage(frame, func(string) bool { return false })
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if msg.raw == nil || msg.Payload != nil {
+		t.Fatalf("expected only the header to be decoded, got %+v", msg)
+	}
+	if msg.Type != "chat" || len(msg.To) != 1 || msg.To[0] != "role:viewer" {
+		t.Fatalf("unexpected header %+v", msg)
+	}
+
+	msg.From, msg.Seq, msg.TS = "alice", 7, 1700000000000
+	data, err := msg.encode()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var got struct {
+		Type    string          `json:"type"`
+		From    string          `json:"from"`
+		Seq     uint64          `json:"seq"`
+		TS      int64           `json:"ts"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("encoded frame is invalid: %v: %s", err, data)
+	}
+	if got.Type != "chat" || got.From != "alice" || got.Seq != 7 || got.TS != 1700000000000 {
+		t.Fatalf("unexpected frame %s", data)
+	}
+	if string(got.Payload) != `{"text":"hi","extra":[1,2]}` {
+		t.Fatalf("expected the payload to be forwarded verbatim, got %s", got.Payload)
+	}
+}
+
+func TestDecodeMessageDecodesInspectedOrStampedFrames(t *testing.T) {
+	inspect := func(msgType string) bool { return msgType == "offer" }
+
+	for _, frame := range []string{
+		`{"type":"offer","to":"bob","payload":{"type":"offer","sdp":"v=0"}}`,
+		`{"type":"chat","from":"mallory","payload":{}}`,
+		`{"type":"chat","seq":99,"payload":{}}`,
+		`{"type":"chat","to":"bob","id":"m1","ack":true,"payload":{}}`,
+		`{"TYPE":"chat","payload":{}}`,
+		`{"type":"chat","To":"bob","payload":{}}`,
+	} {
+		msg, err := decodeMessage([]byte(frame), inspect)
+		if err != nil {
+			t.Fatalf("decode %s failed: %v", frame, err)
+		}
+		if msg.raw != nil || msg.Payload == nil {
+			t.Fatalf("expected %s to be fully decoded, got %+v", frame, msg)
+		}
+	}
+
+	msg, _ := decodeMessage([]byte(`{"type":"chat","from":"mallory","payload":{}}`), inspect)
+	msg.From = "alice"
+	data, _ := msg.encode()
+	var got Message
+	if err := json.Unmarshal(data, &got); err != nil || got.From != "alice" {
+		t.Fatalf("expected the hub to override from, got %s", data)
+	}
+}
+
+func TestDecodeMessageNormalizesHeaderKeyCase(t *testing.T) {
+	msg, err := decodeMessage([]byte(`{"TYPE":"chat","payload":{"text":"hi"}}`), func(string) bool { return false })
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	msg.From = "alice"
+	data, err := msg.encode()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("encoded frame is invalid: %v: %s", err, data)
+	}
+	if string(got["type"]) != `"chat"` {
+		t.Fatalf("expected a lowercase type key, got %s", data)
+	}
+	if _, ok := got["TYPE"]; ok {
+		t.Fatalf("expected the original key to be dropped, got %s", data)
+	}
+}
@@ -0,0 +1,133 @@
+package signaling
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/uoxou-moe/rabbit-rtc/backend/internal/metrics"
+)
+
+// Register failure reasons reported by rabbit_signaling_register_failures_total.
+const (
+	registerFailurePeerExists        = "peer_exists"
+	registerFailureBroadcasterExists = "broadcaster_exists"
+	registerFailureRejoinBlocked     = "rejoin_blocked"
+	registerFailureInternal          = "internal"
+)
+
+var (
+	queueDepthBuckets   = []float64{0, 1, 2, 4, 8, 16, 32, 64}
+	writeLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+)
+
+// hubMetrics are the instruments a hub updates while it runs.
+type hubMetrics struct {
+	registry         *metrics.Registry
+	joins            *metrics.Counter
+	leaves           *metrics.Counter
+	routed           *metrics.CounterVec
+	rejectedOrigins  *metrics.Counter
+	registerFailures *metrics.CounterVec
+	queueDepth       *metrics.Histogram
+	writeLatency     *metrics.Histogram
+	// peers counts the connected peers by role. Rooms update it as clients
+	// join and leave, so that a scrape never waits on a room goroutine.
+	peers map[Role]*atomic.Int64
+}
+
+func newHubMetrics(h *Hub) *hubMetrics {
+	reg := metrics.NewRegistry()
+	reg.GaugeFunc("rabbit_signaling_rooms", "Rooms currently open on this hub.", func() float64 {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return float64(len(h.rooms))
+	})
+	peers := map[Role]*atomic.Int64{
+		RoleBroadcaster: new(atomic.Int64),
+		RoleViewer:      new(atomic.Int64),
+	}
+	reg.GaugeVecFunc("rabbit_signaling_peers", "Peers currently connected to this hub.", "role", func() map[string]float64 {
+		counts := make(map[string]float64, len(peers))
+		for role, n := range peers {
+			counts[string(role)] = float64(n.Load())
+		}
+		return counts
+	})
+	reg.CounterFunc("rabbit_signaling_messages_dropped_total",
+		"Frames dropped because a send queue or broker outbox was full, or a detached peer never resumed.", h.dropped.Load)
+
+	return &hubMetrics{
+		registry: reg,
+		joins:    reg.Counter("rabbit_signaling_joins_total", "Peers that joined a room."),
+		leaves:   reg.Counter("rabbit_signaling_leaves_total", "Peers that left a room."),
+		routed: reg.CounterVec("rabbit_signaling_messages_routed_total",
+			"Messages routed by type. Types without a schema are counted as other.", "type", h.routedTypes()),
+		rejectedOrigins: reg.Counter("rabbit_signaling_rejected_origins_total", "WebSocket upgrades rejected for their origin."),
+		registerFailures: reg.CounterVec("rabbit_signaling_register_failures_total",
+			"Connections that could not join their room, by reason.", "reason", nil),
+		queueDepth: reg.Histogram("rabbit_signaling_send_queue_depth",
+			"Frames waiting in a send queue when its write loop wakes.", queueDepthBuckets),
+		writeLatency: reg.Histogram("rabbit_signaling_write_duration_seconds",
+			"Time spent writing one frame to a WebSocket.", writeLatencyBuckets),
+		peers: peers,
+	}
+}
+
+// routedTypes returns the message types counted under their own label by
+// rabbit_signaling_messages_routed_total. Clients choose the types, so only
+// the WebRTC handshake and the types with a schema are known in advance.
+func (h *Hub) routedTypes() []string {
+	types := h.schemas.types()
+	for msgType := range priorityTypes {
+		if !h.schemas.has(msgType) {
+			types = append(types, msgType)
+		}
+	}
+	return types
+}
+
+// WriteMetrics writes the metrics of the hub in the Prometheus text
+// exposition format.
+func (h *Hub) WriteMetrics(w io.Writer) error {
+	_, err := h.metrics.registry.WriteTo(w)
+	return err
+}
+
+// addPeers adjusts the connected peers of role by delta.
+func (m *hubMetrics) addPeers(role Role, delta int64) {
+	if n, ok := m.peers[role]; ok {
+		n.Add(delta)
+	}
+}
+
+// roomList returns a snapshot of the open rooms.
+func (h *Hub) roomList() []*room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rooms := make([]*room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+// registerFailureReason classifies an error returned by register.
+func registerFailureReason(err error) string {
+	switch {
+	case errors.Is(err, errPeerExists):
+		return registerFailurePeerExists
+	case errors.Is(err, errBroadcasterExists):
+		return registerFailureBroadcasterExists
+	case errors.Is(err, errRejoinBlocked):
+		return registerFailureRejoinBlocked
+	default:
+		return registerFailureInternal
+	}
+}
+
+// observeWrite records the duration of a frame write that started at start.
+func (m *hubMetrics) observeWrite(start time.Time) {
+	m.writeLatency.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,297 @@
+package signaling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PolicyConfig selects the media policies applied to each room.
+type PolicyConfig struct {
+	// Default applies to rooms without an entry in Rooms.
+	Default RoomPolicy `json:"default"`
+	// Rooms overrides the default per room ID. Policies left unset in a room
+	// entry fall back to the default.
+	Rooms map[string]RoomPolicy `json:"rooms"`
+}
+
+// RoomPolicy groups the policies enforced on a room's signaling traffic.
+type RoomPolicy struct {
+	SDP *SDPPolicy `json:"sdp,omitempty"`
+	ICE *ICEPolicy `json:"ice,omitempty"`
+}
+
+// ParsePolicyConfig decodes and validates a JSON policy document.
+func ParsePolicyConfig(data []byte) (PolicyConfig, error) {
+	var cfg PolicyConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return PolicyConfig{}, err
+	}
+
+	if err := cfg.Default.validate(); err != nil {
+		return PolicyConfig{}, fmt.Errorf("default: %w", err)
+	}
+	for id, policy := range cfg.Rooms {
+		if err := policy.validate(); err != nil {
+			return PolicyConfig{}, fmt.Errorf("room %q: %w", id, err)
+		}
+	}
+	return cfg, nil
+}
+
+// forRoom returns the policy of roomID, filling unset policies from Default.
+func (cfg PolicyConfig) forRoom(roomID string) RoomPolicy {
+	policy, ok := cfg.Rooms[roomID]
+	if !ok {
+		return cfg.Default
+	}
+	if policy.SDP == nil {
+		policy.SDP = cfg.Default.SDP
+	}
+	if policy.ICE == nil {
+		policy.ICE = cfg.Default.ICE
+	}
+	return policy
+}
+
+func (p RoomPolicy) validate() error {
+	if p.SDP != nil {
+		if err := p.SDP.validate(); err != nil {
+			return fmt.Errorf("sdp: %w", err)
+		}
+	}
+	if p.ICE != nil {
+		if err := p.ICE.validate(); err != nil {
+			return fmt.Errorf("ice: %w", err)
+		}
+	}
+	return nil
+}
+
+// ViolationAction is what a policy does when a description violates it.
+type ViolationAction string
+
+const (
+	// ViolationStrip disables the media sections whose kind is not allowed
+	// and forwards the rest of the description. Other violations are logged.
+	ViolationStrip ViolationAction = "strip"
+	// ViolationLog forwards the description and only logs the violation.
+	ViolationLog ViolationAction = "log"
+	// ViolationReject withholds the message and reports an error to the sender.
+	ViolationReject ViolationAction = "reject"
+)
+
+// SDPPolicy rewrites the session descriptions carried by offer and answer
+// messages. Codec names are matched case-insensitively, e.g. "H264" or "opus".
+type SDPPolicy struct {
+	// PreferCodecs moves these codecs to the front of each media section,
+	// in the given order.
+	PreferCodecs []string `json:"preferCodecs,omitempty"`
+	// StripCodecs removes these codecs and their retransmission formats.
+	StripCodecs []string `json:"stripCodecs,omitempty"`
+	// VideoBitrateKbps and AudioBitrateKbps set b=AS and b=TIAS lines on the
+	// media sections of that kind. Zero leaves the section unchanged.
+	VideoBitrateKbps int `json:"videoBitrateKbps,omitempty"`
+	AudioBitrateKbps int `json:"audioBitrateKbps,omitempty"`
+	// AllowedMedia lists the permitted media kinds such as "audio", "video"
+	// or "application". Empty allows every kind.
+	AllowedMedia []string `json:"allowedMedia,omitempty"`
+	// OnViolation is ViolationStrip (the default), ViolationLog or
+	// ViolationReject.
+	OnViolation ViolationAction `json:"onViolation,omitempty"`
+}
+
+// action returns OnViolation, or ViolationStrip when it is unset.
+func (p *SDPPolicy) action() ViolationAction {
+	if p.OnViolation == "" {
+		return ViolationStrip
+	}
+	return p.OnViolation
+}
+
+func (p *SDPPolicy) validate() error {
+	switch p.OnViolation {
+	case "", ViolationStrip, ViolationLog, ViolationReject:
+	default:
+		return fmt.Errorf("unknown onViolation %q", p.OnViolation)
+	}
+	if p.VideoBitrateKbps < 0 || p.AudioBitrateKbps < 0 {
+		return fmt.Errorf("bitrates must not be negative")
+	}
+	return nil
+}
+
+// apply rewrites sdp according to the policy and returns the result together
+// with the violations found. Media sections of a kind that is not allowed are
+// disabled under ViolationStrip. Media sections that would lose every codec
+// keep their original codecs and are reported as a violation instead.
+func (p *SDPPolicy) apply(sdp string) (string, []string) {
+	desc := parseSDP(sdp)
+	var violations []string
+
+	for _, m := range desc.media {
+		if len(p.AllowedMedia) > 0 && !containsFold(p.AllowedMedia, m.kind) {
+			violations = append(violations, fmt.Sprintf("media %q not allowed", m.kind))
+			if p.action() == ViolationStrip {
+				desc.disable(m)
+				continue
+			}
+		}
+
+		if len(p.StripCodecs) > 0 {
+			if !p.strip(m) {
+				violations = append(violations, fmt.Sprintf("no codecs left in %s section", m.kind))
+			}
+		}
+		if len(p.PreferCodecs) > 0 {
+			p.reorder(m)
+		}
+
+		switch {
+		case m.kind == "video" && p.VideoBitrateKbps > 0:
+			m.setBandwidth(p.VideoBitrateKbps)
+		case m.kind == "audio" && p.AudioBitrateKbps > 0:
+			m.setBandwidth(p.AudioBitrateKbps)
+		}
+	}
+
+	return desc.String(), violations
+}
+
+// strip removes the stripped codecs from m and reports false, leaving m
+// unchanged, when no codec would remain.
+func (p *SDPPolicy) strip(m *mediaSection) bool {
+	codecs := m.codecs()
+	if len(codecs) == 0 {
+		return true
+	}
+
+	removed := make(map[string]bool)
+	for pt, name := range codecs {
+		if containsFold(p.StripCodecs, name) {
+			removed[pt] = true
+		}
+	}
+	if len(removed) == 0 {
+		return true
+	}
+	for rtx, apt := range m.associated() {
+		if removed[apt] {
+			removed[rtx] = true
+		}
+	}
+
+	remaining := 0
+	for _, pt := range m.formats {
+		if !removed[pt] {
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		return false
+	}
+
+	m.removeFormats(removed)
+	return true
+}
+
+// reorder moves preferred codecs, followed by their retransmission formats,
+// to the front of the m= line while keeping the relative order of the rest.
+func (p *SDPPolicy) reorder(m *mediaSection) {
+	codecs := m.codecs()
+	associated := m.associated()
+
+	rank := func(pt string) int {
+		name := codecs[pt]
+		if apt, ok := associated[pt]; ok {
+			name = codecs[apt]
+		}
+		for i, preferred := range p.PreferCodecs {
+			if strings.EqualFold(preferred, name) {
+				return i
+			}
+		}
+		return len(p.PreferCodecs)
+	}
+
+	formats := make([]string, 0, len(m.formats))
+	for i := 0; i <= len(p.PreferCodecs); i++ {
+		for _, pt := range m.formats {
+			if rank(pt) == i {
+				formats = append(formats, pt)
+			}
+		}
+	}
+	m.formats = formats
+}
+
+// rewriteDescription applies the policy to an offer or answer payload and
+// reports the violations found.
+func (p *SDPPolicy) rewriteDescription(payload json.RawMessage) (json.RawMessage, []string, error) {
+	var violations []string
+	out, err := rewriteSDPField(payload, func(sdp string) string {
+		var rewritten string
+		rewritten, violations = p.apply(sdp)
+		return rewritten
+	})
+	return out, violations, err
+}
+
+// rewriteSDPField replaces the sdp field of a session description payload
+// with rewrite's result, keeping every other field.
+func rewriteSDPField(payload json.RawMessage, rewrite func(string) string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	var sdp string
+	if err := json.Unmarshal(fields["sdp"], &sdp); err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(rewrite(sdp))
+	if err != nil {
+		return nil, err
+	}
+	fields["sdp"] = raw
+	return json.Marshal(fields)
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applySDPPolicy rewrites the description of an offer or answer according to
+// the room's SDP policy. It reports false when the message was rejected.
+func (r *room) applySDPPolicy(from *Client, msg *Message) bool {
+	policy := r.policy.SDP
+	if policy == nil || (msg.Type != "offer" && msg.Type != "answer") {
+		return true
+	}
+
+	payload, violations, err := policy.rewriteDescription(msg.Payload)
+	if err != nil {
+		from.sendError(messageError(CodeInvalidPayload, fmt.Sprintf("invalid %s payload: sdp is required", msg.Type), *msg))
+		return false
+	}
+
+	if len(violations) > 0 {
+		reason := strings.Join(violations, "; ")
+		r.logger.Warn("sdp policy violation", "peer", from.peerID, "type", msg.Type, "violations", reason, "action", policy.action())
+		if policy.action() == ViolationReject {
+			from.sendError(messageError(CodePolicyViolation, "sdp policy violation: "+reason, *msg))
+			return false
+		}
+	}
+
+	msg.Payload = payload
+	return true
+}
@@ -0,0 +1,115 @@
+package signaling
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOfferSDP = "v=0\r\n" +
+	"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96 97 102 103\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"b=AS:5000\r\n" +
+	"a=rtpmap:96 VP8/90000\r\n" +
+	"a=rtcp-fb:96 nack\r\n" +
+	"a=rtpmap:97 rtx/90000\r\n" +
+	"a=fmtp:97 apt=96\r\n" +
+	"a=rtpmap:102 H264/90000\r\n" +
+	"a=fmtp:102 profile-level-id=42e01f\r\n" +
+	"a=rtpmap:103 rtx/90000\r\n" +
+	"a=fmtp:103 apt=102\r\n"
+
+func TestSDPPolicyReordersCodecsAndCapsBandwidth(t *testing.T) {
+	policy := &SDPPolicy{PreferCodecs: []string{"h264"}, VideoBitrateKbps: 2500, AudioBitrateKbps: 96}
+
+	out, violations := policy.apply(testOfferSDP)
+	if len(violations) != 0 {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+
+	for _, want := range []string{
+		"m=video 9 UDP/TLS/RTP/SAVPF 102 103 96 97\r\nc=IN IP4 0.0.0.0\r\nb=AS:2500\r\nb=TIAS:2500000\r\n",
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\nc=IN IP4 0.0.0.0\r\nb=AS:96\r\nb=TIAS:96000\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in rewritten sdp:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "b=AS:5000") {
+		t.Fatalf("expected previous bandwidth line to be replaced:\n%s", out)
+	}
+}
+
+func TestSDPPolicyStripsCodecsWithRetransmission(t *testing.T) {
+	policy := &SDPPolicy{StripCodecs: []string{"VP8"}}
+
+	out, violations := policy.apply(testOfferSDP)
+	if len(violations) != 0 {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+	if !strings.Contains(out, "m=video 9 UDP/TLS/RTP/SAVPF 102 103\r\n") {
+		t.Fatalf("expected VP8 and its rtx to be removed from the m= line:\n%s", out)
+	}
+	for _, gone := range []string{"a=rtpmap:96 ", "a=rtcp-fb:96 ", "a=rtpmap:97 ", "a=fmtp:97 "} {
+		if strings.Contains(out, gone) {
+			t.Fatalf("expected %q to be removed:\n%s", gone, out)
+		}
+	}
+}
+
+func TestSDPPolicyReportsViolations(t *testing.T) {
+	policy := &SDPPolicy{StripCodecs: []string{"opus"}, AllowedMedia: []string{"video"}, OnViolation: ViolationLog}
+
+	out, violations := policy.apply(testOfferSDP)
+	if len(violations) != 2 {
+		t.Fatalf("expected disallowed audio and empty audio section, got %v", violations)
+	}
+	if !strings.Contains(out, "a=rtpmap:111 opus/48000/2") {
+		t.Fatalf("expected the last codec of a section to be kept:\n%s", out)
+	}
+}
+
+func TestSDPPolicyDisablesDisallowedMediaByDefault(t *testing.T) {
+	policy := &SDPPolicy{AllowedMedia: []string{"video"}}
+	sdp := strings.Replace(testOfferSDP, "t=0 0\r\n", "t=0 0\r\na=group:BUNDLE 0 1\r\n", 1)
+	sdp = strings.Replace(sdp, "a=rtpmap:111 opus/48000/2\r\n", "a=mid:0\r\na=rtpmap:111 opus/48000/2\r\n", 1)
+
+	out, violations := policy.apply(sdp)
+	if len(violations) != 1 {
+		t.Fatalf("expected disallowed audio to be reported, got %v", violations)
+	}
+	for _, want := range []string{"a=group:BUNDLE 1\r\n", "m=audio 0 UDP/TLS/RTP/SAVPF 111\r\n", "m=video 9 UDP/TLS/RTP/SAVPF 96 97 102 103\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestParsePolicyConfigFallsBackToDefault(t *testing.T) {
+	cfg, err := ParsePolicyConfig([]byte(`{
+		"default": {"sdp": {"preferCodecs": ["H264"]}},
+		"rooms": {"strict": {"sdp": {"allowedMedia": ["video"], "onViolation": "reject"}}, "plain": {}}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.forRoom("other").SDP; got == nil || got.PreferCodecs[0] != "H264" {
+		t.Fatalf("expected default policy for unknown room, got %+v", got)
+	}
+	if got := cfg.forRoom("strict").SDP; got == nil || got.OnViolation != ViolationReject {
+		t.Fatalf("expected room override, got %+v", got)
+	}
+	if got := cfg.forRoom("plain").SDP; got == nil || got.PreferCodecs[0] != "H264" {
+		t.Fatalf("expected unset room policy to fall back to default, got %+v", got)
+	}
+
+	if _, err := ParsePolicyConfig([]byte(`{"default": {"sdp": {"onViolation": "drop"}}}`)); err == nil {
+		t.Fatalf("expected unknown onViolation to be rejected")
+	}
+}
@@ -0,0 +1,136 @@
+package signaling
+
+import "time"
+
+// RateLimit configures a token bucket. A zero Rate disables the limit.
+type RateLimit struct {
+	// Rate is the number of frames replenished per second.
+	Rate float64
+	// Burst is the bucket capacity. Values below 1 are treated as 1.
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+// RateLimitConfig configures inbound flood protection for each peer.
+type RateLimitConfig struct {
+	// PerPeer limits every inbound frame of a peer regardless of its type.
+	PerPeer RateLimit
+	// PerType limits frames of a given message type.
+	PerType map[string]RateLimit
+	// MaxViolations is the number of rejected frames within ViolationWindow
+	// after which the peer is disconnected. Zero never disconnects.
+	MaxViolations int
+	// ViolationWindow resets the violation count. Zero never resets it.
+	ViolationWindow time.Duration
+}
+
+func (cfg RateLimitConfig) enabled() bool {
+	if cfg.PerPeer.enabled() {
+		return true
+	}
+	for _, limit := range cfg.PerType {
+		if limit.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimiter tracks the buckets of a single peer. It is only used from the
+// client's read loop and therefore needs no locking.
+type rateLimiter struct {
+	cfg         RateLimitConfig
+	peer        *tokenBucket
+	types       map[string]*tokenBucket
+	violations  int
+	windowStart time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig, now time.Time) *rateLimiter {
+	if !cfg.enabled() {
+		return nil
+	}
+
+	l := &rateLimiter{
+		cfg:         cfg,
+		types:       make(map[string]*tokenBucket),
+		windowStart: now,
+	}
+	if cfg.PerPeer.enabled() {
+		l.peer = newTokenBucket(cfg.PerPeer, now)
+	}
+	return l
+}
+
+// allowFrame applies the per-peer limit to an inbound frame.
+func (l *rateLimiter) allowFrame(now time.Time) bool {
+	if l == nil || l.peer == nil {
+		return true
+	}
+	return l.peer.allow(now)
+}
+
+// allowType applies the limit configured for msgType, if any.
+func (l *rateLimiter) allowType(msgType string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	limit, ok := l.cfg.PerType[msgType]
+	if !ok || !limit.enabled() {
+		return true
+	}
+
+	bucket, ok := l.types[msgType]
+	if !ok {
+		bucket = newTokenBucket(limit, now)
+		l.types[msgType] = bucket
+	}
+	return bucket.allow(now)
+}
+
+// violate records a rejected frame and reports whether the peer exceeded
+// MaxViolations.
+func (l *rateLimiter) violate(now time.Time) bool {
+	if l.cfg.ViolationWindow > 0 && now.Sub(l.windowStart) > l.cfg.ViolationWindow {
+		l.violations = 0
+		l.windowStart = now
+	}
+
+	l.violations++
+	return l.cfg.MaxViolations > 0 && l.violations >= l.cfg.MaxViolations
+}
@@ -0,0 +1,69 @@
+package signaling
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+)
+
+const defaultResumeBufferSize = 64
+
+// ResumeConfig controls session resumption after an unexpected disconnect.
+type ResumeConfig struct {
+	// Grace is how long a disconnected peer keeps its slot. Zero disables
+	// resumption.
+	Grace time.Duration
+	// BufferSize bounds the frames held for a disconnected peer. Defaults to 64.
+	BufferSize int
+}
+
+func (cfg ResumeConfig) withDefaults() ResumeConfig {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultResumeBufferSize
+	}
+	return cfg
+}
+
+func (cfg ResumeConfig) enabled() bool {
+	return cfg.Grace > 0
+}
+
+// detachedPeer holds the slot of a peer whose socket dropped until it resumes
+// or the grace period expires. It is owned by the room goroutine.
+type detachedPeer struct {
+	peerID string
+	role   Role
+	token  string
+	buffer []outbound
+	since  time.Time
+	timer  *time.Timer
+}
+
+// hold buffers item for replay, evicting the oldest frame when the buffer is
+// full. It returns the evicted frame, if any.
+func (d *detachedPeer) hold(item outbound, limit int) (outbound, bool) {
+	var evicted outbound
+	hasEvicted := false
+	if len(d.buffer) >= limit {
+		evicted, hasEvicted = d.buffer[0], true
+		d.buffer = d.buffer[1:]
+	}
+	d.buffer = append(d.buffer, item)
+	return evicted, hasEvicted
+}
+
+func newResumeToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic("signaling: failed to read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func resumeTokenMatches(expected, presented string) bool {
+	if expected == "" || presented == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(presented)) == 1
+}
@@ -0,0 +1,67 @@
+package signaling
+
+// maxRetainedPerPeer bounds the message types a single peer may retain.
+const maxRetainedPerPeer = 16
+
+// retainedMessage is the latest message of one type retained by a peer. It is
+// owned by the room goroutine.
+type retainedMessage struct {
+	from    string
+	role    Role
+	msgType string
+	item    outbound
+}
+
+// retain stores item as the latest retained message of its type from from. It
+// reports false when from already retains too many types.
+func (r *room) retain(from *Client, item outbound) bool {
+	// replays are not tied to the sending connection and are not acked
+	item.from = nil
+	item.ack = false
+	entry := retainedMessage{from: from.peerID, role: from.role, msgType: item.msgType, item: item}
+
+	count := 0
+	for i, retained := range r.retained {
+		if retained.from != from.peerID {
+			continue
+		}
+		if retained.msgType == item.msgType {
+			// keep replay order by recency
+			r.retained = append(r.retained[:i], r.retained[i+1:]...)
+			r.retained = append(r.retained, entry)
+			return true
+		}
+		count++
+	}
+	if count >= maxRetainedPerPeer {
+		return false
+	}
+
+	r.retained = append(r.retained, entry)
+	return true
+}
+
+// retainedFor returns the retained messages c may receive, oldest first.
+func (r *room) retainedFor(c *Client) []outbound {
+	var out []outbound
+	for _, retained := range r.retained {
+		if retained.from != c.peerID && canReach(retained.role, c.role) {
+			out = append(out, retained.item)
+		}
+	}
+	return out
+}
+
+// clearRetained forgets the messages retained by a peer that left.
+func (r *room) clearRetained(peerID string) {
+	kept := r.retained[:0]
+	for _, retained := range r.retained {
+		if retained.from != peerID {
+			kept = append(kept, retained)
+		}
+	}
+	for i := len(kept); i < len(r.retained); i++ {
+		r.retained[i] = retainedMessage{}
+	}
+	r.retained = kept
+}
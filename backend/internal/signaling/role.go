@@ -0,0 +1,32 @@
+package signaling
+
+import "strings"
+
+// Role identifies how a peer takes part in a room.
+type Role string
+
+const (
+	// RoleBroadcaster publishes the stream. A room holds at most one.
+	RoleBroadcaster Role = "broadcaster"
+	// RoleViewer receives the stream and may only talk to the broadcaster.
+	RoleViewer Role = "viewer"
+)
+
+// parseRole converts a query or claim value into a Role. An empty value
+// defaults to RoleViewer.
+func parseRole(raw string) (Role, bool) {
+	switch Role(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", RoleViewer:
+		return RoleViewer, true
+	case RoleBroadcaster:
+		return RoleBroadcaster, true
+	default:
+		return "", false
+	}
+}
+
+// canReach reports whether a peer with role from may exchange messages with a
+// peer with role to. Viewers only talk to the broadcaster.
+func canReach(from, to Role) bool {
+	return from == RoleBroadcaster || to == RoleBroadcaster
+}
@@ -0,0 +1,624 @@
+package signaling
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// roomInboxSize bounds the operations waiting for a room goroutine. Senders
+// block while the inbox is full.
+const roomInboxSize = queueSize
+
+// room keeps track of peers within the same logical signaling session. A room
+// is owned by a single goroutine that runs the joins, leaves and routed
+// messages posted to its inbox one at a time, so every peer observes the
+// frames of a room in the same order. The fields below inbox are only
+// accessed from that goroutine.
+type room struct {
+	id     string
+	hub    *Hub
+	logger *slog.Logger
+	// done is closed when the room is deleted and its goroutine exits.
+	done chan struct{}
+	// joining counts registrations that looked the room up but have not
+	// joined yet. It is incremented with hub.mu held, and the room is not
+	// deleted while it is positive.
+	joining atomic.Int32
+	// pairs is nil unless diagnostics are enabled. It has its own lock as
+	// reports read it from other goroutines.
+	pairs *pairTracker
+	// outbox carries events to the broker in routing order; nil without a
+	// broker.
+	outbox *outbox
+	// joinMu serializes the joins that claim a peer ID across nodes.
+	joinMu sync.Mutex
+
+	// brokerMu guards the broker subscription.
+	brokerMu     sync.Mutex
+	cancel       func()
+	brokerClosed bool
+
+	inbox       chan roomOp
+	clients     map[string]*Client
+	detached    map[string]*detachedPeer
+	broadcaster string
+	// mailbox holds frames for peers that have not joined yet, oldest first.
+	mailbox []*mail
+	// retained holds the latest retained message per sender and type.
+	retained []retainedMessage
+	policy   RoomPolicy
+	// seq is the sequence number of the last routed message.
+	seq uint64
+	// remote holds the peers other nodes claimed in the room.
+	remote map[string]Member
+}
+
+func newRoom(id string, hub *Hub) *room {
+	r := &room{
+		id:       id,
+		hub:      hub,
+		logger:   hub.logger.With("room", id),
+		done:     make(chan struct{}),
+		inbox:    make(chan roomOp, roomInboxSize),
+		clients:  make(map[string]*Client),
+		detached: make(map[string]*detachedPeer),
+		remote:   make(map[string]Member),
+		policy:   hub.policies.forRoom(id),
+	}
+	if hub.diagnostics {
+		r.pairs = newPairTracker()
+	}
+	if hub.broker != nil {
+		r.outbox = newOutbox()
+		go r.publishLoop()
+	}
+	go r.run()
+	return r
+}
+
+// roomOp is an operation for the room goroutine: a routed message, or fn when
+// set. Messages are passed by value so that routing does not allocate a
+// closure per frame.
+type roomOp struct {
+	fn   func()
+	ctx  context.Context
+	from *Client
+	msg  Message
+}
+
+// run executes the operations posted to the room in order until the room is
+// deleted.
+func (r *room) run() {
+	for {
+		op := <-r.inbox
+		if op.fn != nil {
+			op.fn()
+		} else {
+			r.dispatch(op.ctx, op.from, op.msg)
+			<-op.from.routing
+		}
+		if r.closeIfIdle() {
+			return
+		}
+	}
+}
+
+// do posts fn to the room goroutine. It reports false when the room has been
+// deleted, in which case fn never runs.
+func (r *room) do(fn func()) bool {
+	return r.send(roomOp{fn: fn})
+}
+
+// route posts a message from a member of the room for routing. A sender may
+// have at most half a send queue of messages waiting to be routed, so that it
+// cannot run so far ahead of its recipients that their queues overflow while
+// the room goroutine fans its messages out.
+func (r *room) route(ctx context.Context, from *Client, msg Message) bool {
+	select {
+	case from.routing <- struct{}{}:
+	case <-r.done:
+		return false
+	}
+	if !r.send(roomOp{ctx: ctx, from: from, msg: msg}) {
+		<-from.routing
+		return false
+	}
+	return true
+}
+
+func (r *room) send(op roomOp) bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
+
+	select {
+	case r.inbox <- op:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// call runs op on the room goroutine and waits for it. It must not be used
+// from the room goroutine itself.
+func (r *room) call(op func()) bool {
+	finished := make(chan struct{})
+	if !r.do(func() {
+		op()
+		close(finished)
+	}) {
+		return false
+	}
+
+	select {
+	case <-finished:
+		return true
+	case <-r.done:
+		select {
+		case <-finished:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// closeIfIdle deletes the room once nobody is in it or joining it. Operations
+// still in the inbox are discarded; they can only come from peers that left.
+func (r *room) closeIfIdle() bool {
+	if len(r.clients) > 0 || len(r.detached) > 0 || r.joining.Load() > 0 {
+		return false
+	}
+
+	h := r.hub
+	h.mu.Lock()
+	if r.joining.Load() > 0 {
+		h.mu.Unlock()
+		return false
+	}
+	if h.rooms[r.id] == r {
+		delete(h.rooms, r.id)
+	}
+	close(r.done)
+	h.mu.Unlock()
+
+	for _, m := range r.mailbox {
+		m.timer.Stop()
+	}
+	if r.outbox != nil {
+		r.outbox.close()
+	}
+	r.detach()
+	return true
+}
+
+// joinResult describes the outcome of addClient.
+type joinResult struct {
+	// replaced is a stale connection of the same peer ID that must be closed.
+	replaced *Client
+	// left is set when the newcomer evicted another session of its peer ID,
+	// whose departure must be announced before the join.
+	left    *PeerInfo
+	resumed bool
+	// abandoned are the frames the evicted session never received.
+	abandoned []outbound
+	// refused are mailbox frames whose senders may not reach the newcomer.
+	refused []outbound
+}
+
+type joinAction int
+
+const (
+	joinFresh joinAction = iota
+	joinResume
+	joinReplace
+	joinSuffix
+)
+
+// addClient registers c in the room and enqueues its welcome message. A
+// client presenting the resume token of a held or stale session takes over
+// that session and receives the frames buffered for it after the welcome.
+// Other ID conflicts are resolved by the duplicate-peer policy of c's role,
+// and a client without a peer ID is assigned one prefixed with its role.
+func (r *room) addClient(c *Client) (joinResult, error) {
+	action, peerID, err := r.planJoin(c)
+	if err != nil {
+		return joinResult{}, err
+	}
+	if peerID != c.peerID {
+		c.setPeerID(peerID)
+	}
+
+	var result joinResult
+	var replay []outbound
+	if action == joinResume || action == joinReplace {
+		buffered, replaced, role := r.takeOver(peerID)
+		result.replaced = replaced
+		if action == joinResume {
+			replay = buffered
+			result.resumed = true
+		} else {
+			r.hub.dropped.Add(uint64(len(buffered)))
+			result.left = &PeerInfo{ID: peerID, Role: role}
+			result.abandoned = buffered
+			r.clearRetained(peerID)
+		}
+	}
+
+	roster := make([]PeerInfo, 0, len(r.clients)+len(r.detached))
+	for id, client := range r.clients {
+		if id == c.peerID || !canReach(c.role, client.role) {
+			continue
+		}
+		roster = append(roster, PeerInfo{ID: id, Role: client.role})
+	}
+	for id, d := range r.detached {
+		if canReach(c.role, d.role) {
+			roster = append(roster, PeerInfo{ID: id, Role: d.role})
+		}
+	}
+	for id, m := range r.remote {
+		if canReach(c.role, m.Role) {
+			roster = append(roster, PeerInfo{ID: id, Role: m.Role})
+		}
+	}
+	sort.Slice(roster, func(i, j int) bool { return roster[i].ID < roster[j].ID })
+
+	r.clients[c.peerID] = c
+	r.hub.metrics.addPeers(c.role, 1)
+	if c.role == RoleBroadcaster {
+		r.broadcaster = c.peerID
+	}
+
+	c.enqueue(outbound{
+		data: newSystemMessage(typeWelcome, WelcomePayload{
+			Peer:        c.peerID,
+			Role:        c.role,
+			Peers:       roster,
+			ResumeToken: c.resumeToken,
+			Resumed:     result.resumed,
+		}),
+		msgType: typeWelcome,
+	})
+	c.queue.pushUnbounded(replay)
+	if !result.resumed {
+		c.queue.pushUnbounded(r.retainedFor(c))
+	}
+	if len(r.mailbox) > 0 {
+		var mail []outbound
+		mail, result.refused = r.collectMail(c)
+		c.queue.pushUnbounded(mail)
+	}
+
+	return result, nil
+}
+
+// planJoin decides how c joins and the peer ID it joins under, without
+// changing the room.
+func (r *room) planJoin(c *Client) (joinAction, string, error) {
+	action, err := r.resolveJoin(c)
+	if err != nil {
+		return action, "", err
+	}
+
+	peerID := c.peerID
+	switch {
+	case peerID == "":
+		peerID = r.uniquePeerID(string(c.role))
+	case action == joinSuffix:
+		peerID = r.uniquePeerID(c.peerID)
+	}
+	if c.role == RoleBroadcaster && r.broadcaster != "" && r.broadcaster != peerID {
+		return action, "", errBroadcasterExists
+	}
+	if _, ok := r.remoteBroadcaster(); ok && c.role == RoleBroadcaster {
+		return action, "", errBroadcasterExists
+	}
+	return action, peerID, nil
+}
+
+// resolveJoin decides how c joins when its peer ID is already taken.
+func (r *room) resolveJoin(c *Client) (joinAction, error) {
+	if c.peerID == "" {
+		return joinFresh, nil
+	}
+
+	var role Role
+	var token string
+	if d, ok := r.detached[c.peerID]; ok {
+		role, token = d.role, d.token
+	} else if existing, ok := r.clients[c.peerID]; ok {
+		role, token = existing.role, existing.resumeToken
+	} else if _, ok := r.remote[c.peerID]; ok {
+		// sessions on other nodes can neither be resumed nor replaced here
+		if r.hub.duplicatePeer.policyFor(c.role) == DuplicateSuffix {
+			return joinSuffix, nil
+		}
+		return joinFresh, errPeerExists
+	} else {
+		return joinFresh, nil
+	}
+
+	if role == c.role && resumeTokenMatches(token, c.resumeRequest) {
+		return joinResume, nil
+	}
+
+	switch r.hub.duplicatePeer.policyFor(c.role) {
+	case DuplicateReplace:
+		if role != c.role {
+			return joinFresh, errPeerExists
+		}
+		return joinReplace, nil
+	case DuplicateSuffix:
+		return joinSuffix, nil
+	default:
+		return joinFresh, errPeerExists
+	}
+}
+
+// takeOver releases the session currently holding peerID. It returns
+// the frames that session had not received, its connection if it was still
+// registered, and its role.
+func (r *room) takeOver(peerID string) ([]outbound, *Client, Role) {
+	if d, ok := r.detached[peerID]; ok {
+		d.timer.Stop()
+		delete(r.detached, peerID)
+		return d.buffer, nil, d.role
+	}
+
+	existing := r.clients[peerID]
+	existing.shutdown()
+	delete(r.clients, peerID)
+	r.hub.metrics.addPeers(existing.role, -1)
+	return existing.queue.drain(), existing, existing.role
+}
+
+// removeClient removes c if it is still the registered client for its peer
+// ID. It returns the clients left in the room and whether c was removed.
+func (r *room) removeClient(c *Client) ([]*Client, bool) {
+	removed := false
+	if current, ok := r.clients[c.peerID]; ok && current == c {
+		delete(r.clients, c.peerID)
+		r.hub.metrics.addPeers(c.role, -1)
+		if r.broadcaster == c.peerID {
+			r.broadcaster = ""
+		}
+		r.clearRetained(c.peerID)
+		removed = true
+	}
+
+	return r.list(), removed
+}
+
+// detachClient moves c into the detached set, keeping its slot and any frames
+// it had not yet written. onExpire runs when the grace period elapses.
+func (r *room) detachClient(c *Client, grace time.Duration, onExpire func(*detachedPeer)) bool {
+	if current, ok := r.clients[c.peerID]; !ok || current != c {
+		return false
+	}
+	delete(r.clients, c.peerID)
+	r.hub.metrics.addPeers(c.role, -1)
+
+	d := &detachedPeer{
+		peerID: c.peerID,
+		role:   c.role,
+		token:  c.resumeToken,
+		buffer: c.queue.drain(),
+		since:  time.Now(),
+	}
+	d.timer = time.AfterFunc(grace, func() { onExpire(d) })
+	r.detached[c.peerID] = d
+	return true
+}
+
+// expireDetached releases the slot held by d. It returns the remaining clients
+// and whether d was still held.
+func (r *room) expireDetached(d *detachedPeer) ([]*Client, bool) {
+	if current, ok := r.detached[d.peerID]; !ok || current != d {
+		return nil, false
+	}
+	delete(r.detached, d.peerID)
+	if r.broadcaster == d.peerID {
+		r.broadcaster = ""
+	}
+	r.clearRetained(d.peerID)
+
+	return r.list(), true
+}
+
+func (r *room) dispatch(ctx context.Context, from *Client, msg Message) {
+	if err := msg.To.validate(); err != nil {
+		from.sendError(messageError(CodeInvalidMessage, "invalid recipient", msg))
+		return
+	}
+
+	if !r.applySDPPolicy(from, &msg) || !r.applyICEPolicy(from, &msg) {
+		return
+	}
+
+	ack := msg.Ack && len(msg.To) > 0
+	msg.Ack = false
+	r.seq++
+	msg.Seq = r.seq
+	r.hub.metrics.routed.With(msg.Type).Inc()
+	r.logger.Debug("routing message", "seq", msg.Seq, "from", from.peerID, "type", msg.Type, "to", msg.To)
+	payload, err := from.formatMessage(msg)
+	if err != nil {
+		from.sendError(messageError(CodeEncodeFailed, "failed to encode message", msg))
+		return
+	}
+	item := outbound{data: payload, msgType: msg.Type, from: from, id: msg.ID, ack: ack}
+
+	if to, ok := msg.To.peer(); ok {
+		if r.pairs != nil {
+			r.recordHandshakes(r.pairs.observe(from.peerID, to, msg, time.Now()))
+		}
+		target, role, ok := r.member(to)
+		if !ok {
+			if m, remote := r.remote[to]; remote {
+				r.forwardTo(from, to, m.Role, msg, item)
+				return
+			}
+			if !r.postIfEnabled(to, item) {
+				r.targetNotFound(item, to, msg)
+			}
+			return
+		}
+		if !canReach(from.role, role) {
+			from.sendError(messageError(CodeTargetNotAllowed, "target peer not allowed", msg))
+			return
+		}
+
+		if target == nil {
+			if !r.hold(to, item) && !r.postIfEnabled(to, item) {
+				r.targetNotFound(item, to, msg)
+			}
+			return
+		}
+		target.enqueue(item)
+		return
+	}
+
+	if len(msg.To) > 0 {
+		r.dispatchMulti(from, msg, item)
+		return
+	}
+
+	if msg.Retain && !r.retain(from, item) {
+		from.sendError(messageError(CodeRetainLimit, "too many retained message types", msg))
+		return
+	}
+	clients, detached := r.listReachable(from)
+	item = item.shared(len(clients))
+	for _, client := range clients {
+		client.enqueue(item)
+	}
+	for _, peerID := range detached {
+		r.hold(peerID, item)
+	}
+	if len(r.remote) > 0 {
+		r.forward(from, msg, item, nil)
+	}
+}
+
+// dispatchMulti routes a message addressed to a list of peers, roles or
+// exclusions and reports the named recipients it could not reach.
+func (r *room) dispatchMulti(from *Client, msg Message, item outbound) {
+	clients, detached, missing := r.resolve(from.peerID, from.role, msg.To)
+	item = item.shared(len(clients))
+	for _, client := range clients {
+		client.enqueue(item)
+	}
+	for _, peerID := range detached {
+		if !r.hold(peerID, item) {
+			missing = append(missing, peerID)
+		}
+	}
+
+	var remote, unresolved []string
+	for _, peerID := range missing {
+		if m, ok := r.remote[peerID]; ok && canReach(from.role, m.Role) {
+			remote = append(remote, peerID)
+			continue
+		}
+		if !r.postIfEnabled(peerID, item) {
+			unresolved = append(unresolved, peerID)
+		}
+	}
+	if len(r.remote) > 0 {
+		r.forward(from, msg, item, func(ok bool) {
+			for _, peerID := range remote {
+				forwarded(item, peerID, ok)
+			}
+		})
+	}
+	if len(unresolved) == 0 {
+		return
+	}
+
+	if item.ack {
+		for _, peerID := range unresolved {
+			acknowledge(item, peerID, AckTargetGone)
+		}
+		return
+	}
+	from.sendError(ErrorPayload{
+		Code:    CodeRecipientsMissing,
+		Message: "some recipients were not found",
+		Ref:     msg.ID,
+		Details: &ErrorDetails{Type: msg.Type, To: msg.To, Missing: unresolved},
+	})
+}
+
+// targetNotFound answers a message whose target is not in the room, with a
+// target-gone ack when one was requested.
+func (r *room) targetNotFound(item outbound, to string, msg Message) {
+	if item.ack {
+		acknowledge(item, to, AckTargetGone)
+		return
+	}
+	item.from.sendError(messageError(CodeTargetNotFound, "target peer not found", msg))
+}
+
+// member looks up a peer. The client is nil when the peer is detached.
+func (r *room) member(peerID string) (*Client, Role, bool) {
+	if client, ok := r.clients[peerID]; ok {
+		return client, client.role, true
+	}
+	if d, ok := r.detached[peerID]; ok {
+		return nil, d.role, true
+	}
+	return nil, "", false
+}
+
+// hold buffers item for a detached peer and reports whether the peer is still
+// held. A frame evicted from the full buffer is reported to its sender like
+// any other dropped frame.
+func (r *room) hold(peerID string, item outbound) bool {
+	d, ok := r.detached[peerID]
+	if !ok {
+		return false
+	}
+
+	if evicted, hasEvicted := d.hold(item, r.hub.resume.BufferSize); hasEvicted {
+		r.hub.dropped.Add(1)
+		r.logger.Warn("dropping message held for detached peer", "peer", peerID, "type", evicted.msgType)
+		reportDropped(evicted, peerID)
+	}
+	return true
+}
+
+// listReachable returns the clients, other than from, that from may address,
+// and the IDs of reachable detached peers.
+func (r *room) listReachable(from *Client) ([]*Client, []string) {
+	out := make([]*Client, 0, len(r.clients))
+	for id, client := range r.clients {
+		if id == from.peerID || !canReach(from.role, client.role) {
+			continue
+		}
+		out = append(out, client)
+	}
+
+	var detached []string
+	for id, d := range r.detached {
+		if id != from.peerID && canReach(from.role, d.role) {
+			detached = append(detached, id)
+		}
+	}
+
+	return out, detached
+}
+
+func (r *room) list() []*Client {
+	out := make([]*Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		out = append(out, client)
+	}
+	return out
+}
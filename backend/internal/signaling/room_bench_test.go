@@ -0,0 +1,204 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchRoom is a room of one broadcaster and viewers whose send queues are
+// drained by goroutines standing in for the write loops.
+type benchRoom struct {
+	broadcaster *Client
+	viewers     []*Client
+}
+
+type benchHub struct {
+	hub       *Hub
+	rooms     []benchRoom
+	delivered atomic.Uint64
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newBenchHub(b *testing.B, rooms, peers int) *benchHub {
+	b.Helper()
+
+	bh := &benchHub{
+		hub:  NewHub(HubConfig{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}),
+		stop: make(chan struct{}),
+	}
+	ctx := context.Background()
+	for i := 0; i < rooms; i++ {
+		roomID := fmt.Sprintf("room-%d", i)
+		var br benchRoom
+		for j := 0; j < peers; j++ {
+			role, peerID := RoleViewer, fmt.Sprintf("viewer-%d", j)
+			if j == 0 {
+				role, peerID = RoleBroadcaster, "broadcaster"
+			}
+			c := newClient(bh.hub, roomID, peerID, role, nil)
+			if err := bh.hub.register(ctx, c); err != nil {
+				b.Fatalf("register failed: %v", err)
+			}
+			bh.drain(c)
+			if j == 0 {
+				br.broadcaster = c
+			} else {
+				br.viewers = append(br.viewers, c)
+			}
+		}
+		bh.rooms = append(bh.rooms, br)
+	}
+	bh.settle(b, uint64(rooms*(2*peers-1)))
+	return bh
+}
+
+func (bh *benchHub) drain(c *Client) {
+	bh.wg.Add(1)
+	go func() {
+		defer bh.wg.Done()
+		for {
+			select {
+			case <-bh.stop:
+				return
+			case <-c.queue.ready:
+			}
+			for {
+				if _, ok := c.queue.pop(); !ok {
+					break
+				}
+				bh.delivered.Add(1)
+			}
+		}
+	}()
+}
+
+// settle waits until frames were either delivered or dropped.
+func (bh *benchHub) settle(b *testing.B, frames uint64) {
+	b.Helper()
+	deadline := time.Now().Add(time.Minute)
+	for bh.delivered.Load()+bh.hub.dropped.Load() < frames {
+		if time.Now().After(deadline) {
+			b.Fatalf("only %d of %d frames arrived", bh.delivered.Load()+bh.hub.dropped.Load(), frames)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// reportDrops reports the frames dropped by full send queues per op; dropped
+// frames are not counted as delivered work.
+func (bh *benchHub) reportDrops(b *testing.B) {
+	b.ReportMetric(float64(bh.hub.dropped.Load())/float64(b.N), "drops/op")
+}
+
+func (bh *benchHub) close() {
+	close(bh.stop)
+	bh.wg.Wait()
+}
+
+var benchSizes = []struct{ rooms, peers int }{
+	{rooms: 1000, peers: 10},
+	{rooms: 1000, peers: 100},
+	{rooms: 10, peers: 500},
+}
+
+// BenchmarkHubDispatchTargeted measures viewers of random rooms sending
+// candidates to their broadcaster concurrently.
+func BenchmarkHubDispatchTargeted(b *testing.B) {
+	payload := json.RawMessage(`{"candidate":"candidate:1 1 udp 2122260223 192.0.2.1 54400 typ host","sdpMid":"0"}`)
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("rooms=%d/peers=%d", size.rooms, size.peers), func(b *testing.B) {
+			bh := newBenchHub(b, size.rooms, size.peers)
+			defer bh.close()
+			base := bh.delivered.Load() + bh.hub.dropped.Load()
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					br := bh.rooms[rng.Intn(len(bh.rooms))]
+					from := br.viewers[rng.Intn(len(br.viewers))]
+					bh.hub.dispatch(ctx, from, Message{Type: "ice", To: Recipients{"broadcaster"}, Payload: payload})
+				}
+			})
+			bh.settle(b, base+uint64(b.N))
+			bh.reportDrops(b)
+		})
+	}
+}
+
+// BenchmarkHubDispatchBroadcast measures broadcasters of random rooms sending
+// a message to every viewer concurrently. Each op fans out to the whole room.
+func BenchmarkHubDispatchBroadcast(b *testing.B) {
+	payload := json.RawMessage(`{"text":"hello"}`)
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("rooms=%d/peers=%d", size.rooms, size.peers), func(b *testing.B) {
+			bh := newBenchHub(b, size.rooms, size.peers)
+			defer bh.close()
+			base := bh.delivered.Load() + bh.hub.dropped.Load()
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					br := bh.rooms[rng.Intn(len(bh.rooms))]
+					bh.hub.dispatch(ctx, br.broadcaster, Message{Type: "chat", Payload: payload})
+				}
+			})
+			bh.settle(b, base+uint64(b.N)*uint64(size.peers-1))
+			bh.reportDrops(b)
+		})
+	}
+}
+
+// BenchmarkHubDispatchBroadcastFrames is BenchmarkHubDispatchBroadcast
+// starting from the received frame, as the read loop does. decode=full
+// decodes and re-encodes every frame, decode=header forwards it verbatim.
+func BenchmarkHubDispatchBroadcastFrames(b *testing.B) {
+	frame := []byte(`{"type":"chat","payload":{"text":"hello","meta":{"lang":"ja","tags":["a","b","c"]}}}`)
+	modes := []struct {
+		name    string
+		inspect func(string) bool
+	}{
+		{name: "full", inspect: func(string) bool { return true }},
+		{name: "header", inspect: func(string) bool { return false }},
+	}
+	for _, mode := range modes {
+		b.Run("decode="+mode.name, func(b *testing.B) {
+			const rooms, peers = 100, 100
+			bh := newBenchHub(b, rooms, peers)
+			defer bh.close()
+			base := bh.delivered.Load() + bh.hub.dropped.Load()
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					br := bh.rooms[rng.Intn(len(bh.rooms))]
+					msg, err := decodeMessage(frame, mode.inspect)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					bh.hub.dispatch(ctx, br.broadcaster, msg)
+				}
+			})
+			bh.settle(b, base+uint64(b.N)*uint64(peers-1))
+			bh.reportDrops(b)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+func TestRoomRoutesConcurrentSendersInTotalOrder(t *testing.T) {
+	const viewers, perViewer = 8, 200
+
+	hub := NewHub(HubConfig{
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SlowConsumer: SlowConsumerConfig{QueueSize: viewers*perViewer + 2*viewers},
+	})
+	ctx := context.Background()
+
+	broadcaster := newClient(hub, "order", "broadcaster", RoleBroadcaster, nil)
+	if err := hub.register(ctx, broadcaster); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	senders := make([]*Client, viewers)
+	for i := range senders {
+		senders[i] = newClient(hub, "order", fmt.Sprintf("viewer-%d", i), RoleViewer, nil)
+		if err := hub.register(ctx, senders[i]); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, sender := range senders {
+		wg.Add(1)
+		go func(sender *Client) {
+			defer wg.Done()
+			for i := 0; i < perViewer; i++ {
+				hub.dispatch(ctx, sender, Message{Type: "note", To: Recipients{"broadcaster"}, Payload: json.RawMessage(`{}`)})
+			}
+		}(sender)
+	}
+	wg.Wait()
+	// the inbox is FIFO, so this runs after every message above
+	broadcaster.room.call(func() {})
+
+	var last uint64
+	received := 0
+	for {
+		item, ok := broadcaster.queue.pop()
+		if !ok {
+			break
+		}
+		if item.msgType != "note" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(item.data, &msg); err != nil {
+			t.Fatalf("invalid frame: %v", err)
+		}
+		if msg.Seq <= last {
+			t.Fatalf("expected seq to increase, got %d after %d", msg.Seq, last)
+		}
+		last = msg.Seq
+		received++
+	}
+	if received != viewers*perViewer {
+		t.Fatalf("expected %d messages, got %d", viewers*perViewer, received)
+	}
+}
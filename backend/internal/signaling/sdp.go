@@ -0,0 +1,214 @@
+package signaling
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sessionDescriptionText is a session description split into the session
+// section and its media sections. Only the lines the policies touch are
+// interpreted; everything else is kept verbatim.
+type sessionDescriptionText struct {
+	session []string
+	media   []*mediaSection
+}
+
+// mediaSection is one m= line and the lines that follow it.
+type mediaSection struct {
+	kind    string
+	port    string
+	proto   string
+	formats []string
+	lines   []string
+}
+
+// parseSDP splits raw into sections. It accepts both CRLF and LF line endings.
+func parseSDP(raw string) *sessionDescriptionText {
+	desc := &sessionDescriptionText{}
+	var current *mediaSection
+
+	for _, line := range strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "m=") {
+			current = parseMediaLine(line)
+			desc.media = append(desc.media, current)
+			continue
+		}
+		if current == nil {
+			desc.session = append(desc.session, line)
+		} else {
+			current.lines = append(current.lines, line)
+		}
+	}
+	return desc
+}
+
+func parseMediaLine(line string) *mediaSection {
+	fields := strings.Fields(strings.TrimPrefix(line, "m="))
+	m := &mediaSection{}
+	if len(fields) > 0 {
+		m.kind = fields[0]
+	}
+	if len(fields) > 1 {
+		m.port = fields[1]
+	}
+	if len(fields) > 2 {
+		m.proto = fields[2]
+		m.formats = fields[3:]
+	}
+	return m
+}
+
+// String reassembles the description with CRLF line endings.
+func (d *sessionDescriptionText) String() string {
+	var b strings.Builder
+	for _, line := range d.session {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	for _, m := range d.media {
+		b.WriteString("m=")
+		b.WriteString(strings.Join(append([]string{m.kind, m.port, m.proto}, m.formats...), " "))
+		b.WriteString("\r\n")
+		for _, line := range m.lines {
+			b.WriteString(line)
+			b.WriteString("\r\n")
+		}
+	}
+	return b.String()
+}
+
+// disable rejects m the way RFC 3264 does, by setting its port to zero, and
+// takes it out of the BUNDLE groups of d so that the section indices of the
+// offer and answer still line up.
+func (d *sessionDescriptionText) disable(m *mediaSection) {
+	m.port = "0"
+
+	mid := m.attribute("a=mid:")
+	if mid == "" {
+		return
+	}
+	session := d.session[:0]
+	for _, line := range d.session {
+		if rest, ok := strings.CutPrefix(line, "a=group:BUNDLE"); ok {
+			var mids []string
+			for _, id := range strings.Fields(rest) {
+				if id != mid {
+					mids = append(mids, id)
+				}
+			}
+			if len(mids) == 0 {
+				continue
+			}
+			line = "a=group:BUNDLE " + strings.Join(mids, " ")
+		}
+		session = append(session, line)
+	}
+	d.session = session
+}
+
+// attribute returns the value of the first line of m starting with prefix.
+func (m *mediaSection) attribute(prefix string) string {
+	for _, line := range m.lines {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// codecs maps payload types to lower-case encoding names from a=rtpmap lines.
+func (m *mediaSection) codecs() map[string]string {
+	out := make(map[string]string)
+	for _, line := range m.lines {
+		rest, ok := strings.CutPrefix(line, "a=rtpmap:")
+		if !ok {
+			continue
+		}
+		pt, encoding, ok := strings.Cut(rest, " ")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(encoding, "/")
+		out[pt] = strings.ToLower(name)
+	}
+	return out
+}
+
+// associated maps retransmission payload types to the payload type they
+// protect, from "a=fmtp:<pt> apt=<pt>" lines.
+func (m *mediaSection) associated() map[string]string {
+	out := make(map[string]string)
+	for _, line := range m.lines {
+		rest, ok := strings.CutPrefix(line, "a=fmtp:")
+		if !ok {
+			continue
+		}
+		pt, params, ok := strings.Cut(rest, " ")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if apt, ok := strings.CutPrefix(strings.TrimSpace(param), "apt="); ok {
+				out[pt] = apt
+			}
+		}
+	}
+	return out
+}
+
+// removeFormats drops the payload types in removed from the m= line along
+// with their rtpmap, fmtp and rtcp-fb attributes.
+func (m *mediaSection) removeFormats(removed map[string]bool) {
+	formats := m.formats[:0]
+	for _, pt := range m.formats {
+		if !removed[pt] {
+			formats = append(formats, pt)
+		}
+	}
+	m.formats = formats
+
+	lines := m.lines[:0]
+	for _, line := range m.lines {
+		if pt, ok := formatAttribute(line); ok && removed[pt] {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	m.lines = lines
+}
+
+// formatAttribute returns the payload type a per-format attribute refers to.
+func formatAttribute(line string) (string, bool) {
+	for _, prefix := range []string{"a=rtpmap:", "a=fmtp:", "a=rtcp-fb:"} {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			pt, _, _ := strings.Cut(rest, " ")
+			return pt, true
+		}
+	}
+	return "", false
+}
+
+// setBandwidth replaces any b=AS and b=TIAS lines with the given limit. The
+// new lines go after the i= and c= lines, as RFC 4566 orders them.
+func (m *mediaSection) setBandwidth(kbps int) {
+	lines := make([]string, 0, len(m.lines)+2)
+	insertAt := 0
+	for _, line := range m.lines {
+		if strings.HasPrefix(line, "b=AS:") || strings.HasPrefix(line, "b=TIAS:") {
+			continue
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, "i=") || strings.HasPrefix(line, "c=") {
+			insertAt = len(lines)
+		}
+	}
+
+	bandwidth := []string{
+		"b=AS:" + strconv.Itoa(kbps),
+		"b=TIAS:" + strconv.Itoa(kbps*1000),
+	}
+	m.lines = append(lines[:insertAt], append(bandwidth, lines[insertAt:]...)...)
+}
@@ -0,0 +1,274 @@
+package signaling
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SlowConsumerPolicy selects how the hub treats a peer whose send queue is full.
+type SlowConsumerPolicy string
+
+const (
+	// SlowConsumerDrop drops frames. An offer, answer or ice frame evicts the
+	// oldest queued frame of another type before being dropped itself.
+	SlowConsumerDrop SlowConsumerPolicy = "drop"
+	// SlowConsumerDisconnect closes the slow peer with CloseSlowConsumer.
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+	// SlowConsumerBlock holds frames up to BlockTimeout while waiting for
+	// queue space, then drops them. The sender is not held up meanwhile.
+	SlowConsumerBlock SlowConsumerPolicy = "block"
+)
+
+const defaultBlockTimeout = time.Second
+
+// ParseSlowConsumerPolicy converts a configuration value into a policy.
+func ParseSlowConsumerPolicy(raw string) (SlowConsumerPolicy, bool) {
+	switch policy := SlowConsumerPolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case SlowConsumerDrop, SlowConsumerDisconnect, SlowConsumerBlock:
+		return policy, true
+	default:
+		return "", false
+	}
+}
+
+// SlowConsumerConfig configures the outbound queue of every peer.
+type SlowConsumerConfig struct {
+	// Policy defaults to SlowConsumerDrop.
+	Policy SlowConsumerPolicy
+	// BlockTimeout bounds how long SlowConsumerBlock holds a frame. Defaults
+	// to one second.
+	BlockTimeout time.Duration
+	// QueueSize is the number of frames buffered per peer. Defaults to 16.
+	QueueSize int
+}
+
+func (cfg SlowConsumerConfig) withDefaults() SlowConsumerConfig {
+	if cfg.Policy == "" {
+		cfg.Policy = SlowConsumerDrop
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = defaultBlockTimeout
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = queueSize
+	}
+	return cfg
+}
+
+// priorityTypes are kept in preference to other frames when a queue is full,
+// because losing them breaks the WebRTC handshake.
+var priorityTypes = map[string]struct{}{
+	"offer":  {},
+	"answer": {},
+	"ice":    {},
+}
+
+func isPriorityType(msgType string) bool {
+	_, ok := priorityTypes[msgType]
+	return ok
+}
+
+// outbound is a frame waiting in a client's send queue. The data of a frame
+// routed to several peers is shared by their queues and must not be modified.
+type outbound struct {
+	data []byte
+	// prepared caches the websocket framing of data for a fan-out.
+	prepared *websocket.PreparedMessage
+	msgType  string
+	// from is the client that sent the frame; nil for hub-generated frames.
+	from *Client
+	// id is the sender's message ID, echoed in delivery failure errors.
+	id string
+	// ack requests a delivery status for the sender.
+	ack bool
+	// closeCode, when set, closes the connection once the frame is written.
+	closeCode   int
+	closeReason string
+}
+
+// shared prepares item for delivery to recipients connections, computing the
+// websocket framing once when there are several.
+func (item outbound) shared(recipients int) outbound {
+	if recipients < 2 || item.prepared != nil {
+		return item
+	}
+	if prepared, err := websocket.NewPreparedMessage(websocket.TextMessage, item.data); err == nil {
+		item.prepared = prepared
+	}
+	return item
+}
+
+// write sends item on conn.
+func (item outbound) write(conn *websocket.Conn) error {
+	if item.prepared != nil {
+		return conn.WritePreparedMessage(item.prepared)
+	}
+	return conn.WriteMessage(websocket.TextMessage, item.data)
+}
+
+// sendQueue is a bounded FIFO of outbound frames. Unlike a channel it allows
+// evicting a specific queued frame.
+type sendQueue struct {
+	mu    sync.Mutex
+	items []outbound
+	size  int
+	// blocked holds the frames waiting for space under SlowConsumerBlock,
+	// oldest first. push refuses frames while any wait, so that they keep
+	// their order.
+	blocked []blockedFrame
+	// ready is signalled when frames are available, space when one is popped.
+	ready chan struct{}
+	space chan struct{}
+}
+
+// blockedFrame is a frame waiting for queue space until deadline.
+type blockedFrame struct {
+	item     outbound
+	deadline time.Time
+}
+
+func newSendQueue(size int) *sendQueue {
+	return &sendQueue{
+		items: make([]outbound, 0, size),
+		size:  size,
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}, 1),
+	}
+}
+
+// push appends item and reports whether there was room for it.
+func (q *sendQueue) push(item outbound) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.size || len(q.blocked) > 0 {
+		return false
+	}
+	q.items = append(q.items, item)
+	signal(q.ready)
+	return true
+}
+
+// block adds item to the frames waiting for space until deadline. It reports
+// whether no frame was waiting before, in which case the caller starts moving
+// them into the queue with unblock.
+func (q *sendQueue) block(item outbound, deadline time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.blocked = append(q.blocked, blockedFrame{item: item, deadline: deadline})
+	return len(q.blocked) == 1
+}
+
+// unblock moves waiting frames into the queue while it has room and removes
+// those whose deadline passed by now. It returns the expired frames and the
+// deadline of the oldest frame still waiting, or false when none is.
+func (q *sendQueue) unblock(now time.Time) ([]outbound, time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var expired []outbound
+	for len(q.blocked) > 0 {
+		head := q.blocked[0]
+		switch {
+		case len(q.items) < q.size:
+			q.items = append(q.items, head.item)
+			signal(q.ready)
+		case !now.Before(head.deadline):
+			expired = append(expired, head.item)
+		default:
+			return expired, head.deadline, true
+		}
+		q.blocked[0] = blockedFrame{}
+		q.blocked = q.blocked[1:]
+	}
+	q.blocked = nil
+	return expired, time.Time{}, false
+}
+
+// pushEvicting appends item, evicting the oldest non-priority frame when the
+// queue is full. It returns the evicted frame, if any, and whether item was
+// queued.
+func (q *sendQueue) pushEvicting(item outbound) (outbound, bool, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) < q.size {
+		q.items = append(q.items, item)
+		signal(q.ready)
+		return outbound{}, false, true
+	}
+
+	for i, queued := range q.items {
+		if isPriorityType(queued.msgType) {
+			continue
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		q.items = append(q.items, item)
+		signal(q.ready)
+		return queued, true, true
+	}
+
+	return outbound{}, false, false
+}
+
+// pushUnbounded appends items regardless of the queue size. It is used to
+// replay frames held for a resumed session.
+func (q *sendQueue) pushUnbounded(items []outbound) {
+	if len(items) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = append(q.items, items...)
+	signal(q.ready)
+}
+
+// drain removes and returns all queued frames, followed by the frames
+// waiting for space.
+func (q *sendQueue) drain() []outbound {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items
+	for _, b := range q.blocked {
+		items = append(items, b.item)
+	}
+	q.items = make([]outbound, 0, q.size)
+	q.blocked = nil
+	return items
+}
+
+// pop removes the oldest frame.
+func (q *sendQueue) pop() (outbound, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return outbound{}, false
+	}
+	item := q.items[0]
+	q.items[0] = outbound{}
+	q.items = q.items[1:]
+	signal(q.space)
+	return item, true
+}
+
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,173 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSendQueuePushEvictingPrefersPriorityTypes(t *testing.T) {
+	q := newSendQueue(2)
+
+	if !q.push(outbound{msgType: "offer"}) || !q.push(outbound{msgType: "chat"}) {
+		t.Fatalf("expected queue to accept two frames")
+	}
+	if q.push(outbound{msgType: "ice"}) {
+		t.Fatalf("expected push to fail on a full queue")
+	}
+
+	evicted, hasEvicted, ok := q.pushEvicting(outbound{msgType: "ice"})
+	if !ok || !hasEvicted || evicted.msgType != "chat" {
+		t.Fatalf("expected chat to be evicted for ice, got %+v (evicted=%v, ok=%v)", evicted, hasEvicted, ok)
+	}
+
+	if _, hasEvicted, ok := q.pushEvicting(outbound{msgType: "answer"}); ok || hasEvicted {
+		t.Fatalf("expected answer to be rejected when only priority frames are queued")
+	}
+
+	for _, want := range []string{"offer", "ice"} {
+		item, ok := q.pop()
+		if !ok || item.msgType != want {
+			t.Fatalf("expected %s, got %+v (ok=%v)", want, item, ok)
+		}
+	}
+	if _, ok := q.pop(); ok {
+		t.Fatalf("expected queue to be empty")
+	}
+}
+
+func TestEnqueueDropsNonPriorityNewcomerOnFullQueue(t *testing.T) {
+	hub := NewHub(HubConfig{
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SlowConsumer: SlowConsumerConfig{QueueSize: 2},
+	})
+	c := newClient(hub, "room", "viewer", RoleViewer, nil)
+
+	for _, data := range []string{"chat1", "chat2"} {
+		if got := c.enqueue(outbound{data: []byte(data), msgType: "chat"}); got != enqueueQueued {
+			t.Fatalf("expected %s to be queued, got %v", data, got)
+		}
+	}
+	if got := c.enqueue(outbound{data: []byte("chat3"), msgType: "chat"}); got != enqueueRejected {
+		t.Fatalf("expected chat3 to be dropped on a full queue, got %v", got)
+	}
+
+	for _, want := range []string{"chat1", "chat2"} {
+		item, ok := c.queue.pop()
+		if !ok || string(item.data) != want {
+			t.Fatalf("expected %s, got %q (ok=%v)", want, item.data, ok)
+		}
+	}
+	if got := hub.dropped.Load(); got != 1 {
+		t.Fatalf("expected one dropped frame, got %d", got)
+	}
+}
+
+func TestEnqueueReportsBlockedFrameAsPending(t *testing.T) {
+	hub := NewHub(HubConfig{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SlowConsumer: SlowConsumerConfig{
+			Policy:       SlowConsumerBlock,
+			BlockTimeout: 20 * time.Millisecond,
+			QueueSize:    1,
+		},
+	})
+	c := newClient(hub, "room", "viewer", RoleViewer, nil)
+	defer c.shutdown()
+
+	if got := c.enqueue(outbound{data: []byte("chat1"), msgType: "chat"}); got != enqueueQueued {
+		t.Fatalf("expected chat1 to be queued, got %v", got)
+	}
+	if got := c.enqueue(outbound{data: []byte("chat2"), msgType: "chat"}); got != enqueuePending {
+		t.Fatalf("expected chat2 to be pending on a full queue, got %v", got)
+	}
+
+	// nothing reads, so the pending frame is dropped once it times out
+	deadline := time.Now().Add(time.Second)
+	for c.dropped.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the pending frame to be dropped after the block timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBlockPolicyDoesNotDelayOtherPeers(t *testing.T) {
+	const frames = 5
+
+	hub := NewHub(HubConfig{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SlowConsumer: SlowConsumerConfig{
+			Policy:       SlowConsumerBlock,
+			BlockTimeout: 500 * time.Millisecond,
+			QueueSize:    1,
+		},
+	})
+	ctx := context.Background()
+
+	broadcaster := newClient(hub, "block", "broadcaster", RoleBroadcaster, nil)
+	slow := newClient(hub, "block", "slow", RoleViewer, nil)
+	fast := newClient(hub, "block", "fast", RoleViewer, nil)
+	for _, c := range []*Client{broadcaster, slow, fast} {
+		if err := hub.register(ctx, c); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+	}
+	// the joins queued presence notices; only chat frames matter below
+	for _, c := range []*Client{slow, fast} {
+		c.queue.drain()
+	}
+
+	// the slow viewer never reads, while the fast one reads as frames arrive
+	received := make(chan string, frames)
+	go func() {
+		for {
+			select {
+			case <-fast.done:
+				return
+			case <-fast.queue.ready:
+			}
+			for {
+				item, ok := fast.queue.pop()
+				if !ok {
+					break
+				}
+				received <- item.msgType
+			}
+		}
+	}()
+	defer fast.shutdown()
+
+	start := time.Now()
+	for i := 0; i < frames; i++ {
+		hub.dispatch(ctx, broadcaster, Message{Type: "chat", Payload: json.RawMessage(`{}`)})
+	}
+	for i := 0; i < frames; i++ {
+		select {
+		case msgType := <-received:
+			if msgType != "chat" {
+				t.Fatalf("expected chat, got %s", msgType)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for frame %d of the fast viewer", i+1)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 250*time.Millisecond {
+		t.Fatalf("expected the fast viewer not to wait for the slow one, took %v", elapsed)
+	}
+
+	// the slow viewer keeps one frame and drops the rest once they time out
+	deadline := time.Now().Add(2 * time.Second)
+	for slow.dropped.Load() != frames-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d frames dropped for the slow viewer, got %d", frames-1, slow.dropped.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := slow.queue.len(); got != 1 {
+		t.Fatalf("expected one frame queued for the slow viewer, got %d", got)
+	}
+}
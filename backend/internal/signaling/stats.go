@@ -0,0 +1,53 @@
+package signaling
+
+import (
+	"sort"
+	"time"
+)
+
+// PeerStats is a point-in-time view of a connected peer. RTTMs is zero
+// before the first pong.
+type PeerStats struct {
+	Room        string    `json:"room"`
+	Peer        string    `json:"peer"`
+	Role        Role      `json:"role"`
+	RTTMs       float64   `json:"rttMs"`
+	QueueDepth  int       `json:"queueDepth"`
+	Dropped     uint64    `json:"dropped"`
+	RemoteAddr  string    `json:"remoteAddr,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// PeerStats returns statistics for every connected peer, ordered by room and
+// peer ID.
+func (h *Hub) PeerStats() []PeerStats {
+	out := []PeerStats{}
+	for _, r := range h.roomList() {
+		r.call(func() {
+			for _, c := range r.clients {
+				out = append(out, c.stats())
+			}
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Room != out[j].Room {
+			return out[i].Room < out[j].Room
+		}
+		return out[i].Peer < out[j].Peer
+	})
+	return out
+}
+
+func (c *Client) stats() PeerStats {
+	return PeerStats{
+		Room:        c.roomID,
+		Peer:        c.peerID,
+		Role:        c.role,
+		RTTMs:       milliseconds(c.RTT()),
+		QueueDepth:  c.queue.len(),
+		Dropped:     c.dropped.Load(),
+		RemoteAddr:  c.remoteAddr,
+		ConnectedAt: c.connectedAt,
+	}
+}
@@ -0,0 +1,133 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	errTokenMalformed = errors.New("malformed token")
+	errTokenSignature = errors.New("invalid token signature")
+	errTokenExpired   = errors.New("token expired")
+	errTokenClaims    = errors.New("token claims do not match request")
+)
+
+// jwtHeader is the fixed JOSE header of tokens issued by the hub.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// TokenClaims are the JWT claims carried by a join token.
+type TokenClaims struct {
+	Room      string `json:"room"`
+	Peer      string `json:"sub"`
+	Role      Role   `json:"role"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Expiry returns the expiry time of the claims.
+func (c TokenClaims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// bind checks the requested room, peer and role against the claims. Values
+// omitted from the request are taken from the claims; a missing role claim
+// only grants RoleViewer and a missing peer claim does not bind the peer ID.
+func (c TokenClaims) bind(roomID, peerID, role string) (string, string, string, error) {
+	if roomID == "" {
+		roomID = c.Room
+	} else if roomID != c.Room {
+		return "", "", "", errTokenClaims
+	}
+
+	switch {
+	case peerID == "":
+		peerID = c.Peer
+	case c.Peer != "" && peerID != c.Peer:
+		return "", "", "", errTokenClaims
+	}
+
+	claimRole, ok := parseRole(string(c.Role))
+	if !ok {
+		return "", "", "", errTokenClaims
+	}
+	if role != "" {
+		if parsed, ok := parseRole(role); !ok || parsed != claimRole {
+			return "", "", "", errTokenClaims
+		}
+	}
+
+	return roomID, peerID, string(claimRole), nil
+}
+
+// IssueToken signs claims with secret as an HS256 JWT.
+func IssueToken(secret []byte, claims TokenClaims) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("token secret is empty")
+	}
+	if claims.Room == "" || claims.ExpiresAt == 0 {
+		return "", errors.New("token requires room and expiry")
+	}
+	if claims.Role != "" {
+		if _, ok := parseRole(string(claims.Role)); !ok {
+			return "", errors.New("token role is invalid")
+		}
+	}
+
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(body)
+	return unsigned + "." + signToken(secret, unsigned), nil
+}
+
+// ParseToken verifies the signature and expiry of token and returns its claims.
+func ParseToken(secret []byte, token string, now time.Time) (TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return TokenClaims{}, errTokenMalformed
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return TokenClaims{}, errTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return TokenClaims{}, errTokenMalformed
+	}
+
+	expected := signToken(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return TokenClaims{}, errTokenSignature
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return TokenClaims{}, errTokenMalformed
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return TokenClaims{}, errTokenMalformed
+	}
+
+	if claims.ExpiresAt == 0 || !now.Before(claims.Expiry()) {
+		return TokenClaims{}, errTokenExpired
+	}
+
+	return claims, nil
+}
+
+func signToken(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,185 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Size limits of the built-in schemas.
+const (
+	maxSDPBytes            = 64 << 10
+	maxDescriptionMessage  = maxSDPBytes + 4<<10
+	maxCandidateBytes      = 1 << 10
+	maxCandidateMessage    = 4 << 10
+	maxSDPMidBytes         = 64
+	maxCandidateMLineIndex = 1 << 10
+)
+
+var errMessageTooLarge = errors.New("message too large")
+
+// Validator checks the payload of a message before it is routed. A non-nil
+// error rejects the message and is reported to the sender.
+type Validator func(payload json.RawMessage) error
+
+// MessageSchema describes how messages of one type are checked.
+type MessageSchema struct {
+	// MaxBytes bounds the size of the whole frame. Zero leaves only the
+	// connection-wide read limit.
+	MaxBytes int
+	// Validate checks the payload. Nil accepts any payload.
+	Validate Validator
+}
+
+// SchemaRegistry holds the schemas of validated message types. Types without
+// a schema are forwarded unchecked. It must not be modified once the hub
+// serves connections.
+type SchemaRegistry struct {
+	schemas map[string]MessageSchema
+}
+
+// NewSchemaRegistry returns an empty registry.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: make(map[string]MessageSchema)}
+}
+
+// DefaultSchemaRegistry returns a registry with the built-in offer, answer and
+// ice schemas.
+func DefaultSchemaRegistry() *SchemaRegistry {
+	r := NewSchemaRegistry()
+	r.Register("offer", MessageSchema{MaxBytes: maxDescriptionMessage, Validate: validateDescription("offer")})
+	r.Register("answer", MessageSchema{MaxBytes: maxDescriptionMessage, Validate: validateDescription("answer")})
+	r.Register("ice", MessageSchema{MaxBytes: maxCandidateMessage, Validate: validateCandidate})
+	return r
+}
+
+// Register sets the schema for msgType, replacing any previous one.
+func (r *SchemaRegistry) Register(msgType string, schema MessageSchema) {
+	r.schemas[msgType] = schema
+}
+
+// has reports whether msgType has a schema.
+func (r *SchemaRegistry) has(msgType string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.schemas[msgType]
+	return ok
+}
+
+// types returns the message types with a schema.
+func (r *SchemaRegistry) types() []string {
+	if r == nil {
+		return nil
+	}
+	types := make([]string, 0, len(r.schemas))
+	for msgType := range r.schemas {
+		types = append(types, msgType)
+	}
+	return types
+}
+
+// check validates a frame of frameSize bytes carrying a message of msgType.
+func (r *SchemaRegistry) check(msgType string, frameSize int, payload json.RawMessage) error {
+	if r == nil {
+		return nil
+	}
+	schema, ok := r.schemas[msgType]
+	if !ok {
+		return nil
+	}
+	if schema.MaxBytes > 0 && frameSize > schema.MaxBytes {
+		return errMessageTooLarge
+	}
+	if schema.Validate == nil {
+		return nil
+	}
+	return schema.Validate(payload)
+}
+
+// schemaError converts a failed check into the error sent to the sender.
+func schemaError(err error, msg Message) ErrorPayload {
+	if errors.Is(err, errMessageTooLarge) {
+		return messageError(CodeMessageTooLarge, fmt.Sprintf("%s message too large", msg.Type), msg)
+	}
+	return messageError(CodeInvalidPayload, fmt.Sprintf("invalid %s payload: %v", msg.Type, err), msg)
+}
+
+// sessionDescription mirrors RTCSessionDescriptionInit.
+type sessionDescription struct {
+	Type *string `json:"type"`
+	SDP  *string `json:"sdp"`
+}
+
+// validateDescription checks an RTCSessionDescriptionInit of the given type.
+func validateDescription(descType string) Validator {
+	return func(payload json.RawMessage) error {
+		var desc sessionDescription
+		if err := decodeObject(payload, &desc); err != nil {
+			return err
+		}
+		if desc.Type == nil || *desc.Type != descType {
+			return fmt.Errorf("type must be %q", descType)
+		}
+		if desc.SDP == nil || strings.TrimSpace(*desc.SDP) == "" {
+			return errors.New("sdp is required")
+		}
+		if len(*desc.SDP) > maxSDPBytes {
+			return fmt.Errorf("sdp exceeds %d bytes", maxSDPBytes)
+		}
+		return nil
+	}
+}
+
+// iceCandidate mirrors RTCIceCandidateInit.
+type iceCandidate struct {
+	Candidate     *string `json:"candidate"`
+	SDPMid        *string `json:"sdpMid"`
+	SDPMLineIndex *int    `json:"sdpMLineIndex"`
+}
+
+// validateCandidate checks an RTCIceCandidateInit. An empty candidate string
+// signals the end of candidates.
+func validateCandidate(payload json.RawMessage) error {
+	var c iceCandidate
+	if err := decodeObject(payload, &c); err != nil {
+		return err
+	}
+	if c.Candidate == nil {
+		return errors.New("candidate is required")
+	}
+	if len(*c.Candidate) > maxCandidateBytes {
+		return fmt.Errorf("candidate exceeds %d bytes", maxCandidateBytes)
+	}
+	if *c.Candidate != "" && !strings.HasPrefix(*c.Candidate, "candidate:") {
+		return errors.New(`candidate must start with "candidate:"`)
+	}
+	if c.SDPMid == nil && c.SDPMLineIndex == nil {
+		return errors.New("sdpMid or sdpMLineIndex is required")
+	}
+	if c.SDPMid != nil && len(*c.SDPMid) > maxSDPMidBytes {
+		return fmt.Errorf("sdpMid exceeds %d bytes", maxSDPMidBytes)
+	}
+	if c.SDPMLineIndex != nil && (*c.SDPMLineIndex < 0 || *c.SDPMLineIndex >= maxCandidateMLineIndex) {
+		return errors.New("sdpMLineIndex is out of range")
+	}
+	return nil
+}
+
+// decodeObject unmarshals a JSON object payload, rejecting other JSON values
+// and fields of the wrong type.
+func decodeObject(payload json.RawMessage, v any) error {
+	trimmed := strings.TrimSpace(string(payload))
+	if !strings.HasPrefix(trimmed, "{") {
+		return errors.New("payload must be an object")
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return fmt.Errorf("%s has the wrong type", typeErr.Field)
+		}
+		return errors.New("payload is malformed")
+	}
+	return nil
+}
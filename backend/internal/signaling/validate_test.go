@@ -0,0 +1,45 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDefaultSchemasRejectMalformedPayloads(t *testing.T) {
+	schemas := DefaultSchemaRegistry()
+
+	valid := map[string]string{
+		"offer":  `{"type":"offer","sdp":"v=0\r\n"}`,
+		"answer": `{"type":"answer","sdp":"v=0\r\n"}`,
+		"ice":    `{"candidate":"candidate:1 1 udp 2122260223 192.0.2.1 54321 typ host","sdpMid":"0","sdpMLineIndex":0}`,
+		"chat":   `"anything"`,
+	}
+	for msgType, payload := range valid {
+		if err := schemas.check(msgType, len(payload), json.RawMessage(payload)); err != nil {
+			t.Fatalf("expected valid %s payload, got %v", msgType, err)
+		}
+	}
+
+	invalid := map[string][]string{
+		"offer": {``, `"v=0"`, `{"sdp":"v=0"}`, `{"type":"answer","sdp":"v=0"}`, `{"type":"offer","sdp":42}`, `{"type":"offer"}`},
+		"ice":   {`{"sdpMid":"0"}`, `{"candidate":"host 1","sdpMid":"0"}`, `{"candidate":""}`, `{"candidate":"","sdpMLineIndex":-1}`},
+	}
+	for msgType, payloads := range invalid {
+		for _, payload := range payloads {
+			if err := schemas.check(msgType, len(payload), json.RawMessage(payload)); err == nil {
+				t.Fatalf("expected %s payload %s to be rejected", msgType, payload)
+			}
+		}
+	}
+}
+
+func TestSchemaSizeLimit(t *testing.T) {
+	schemas := DefaultSchemaRegistry()
+	payload := `{"candidate":"","sdpMid":"` + strings.Repeat("x", maxCandidateMessage) + `"}`
+
+	if err := schemas.check("ice", len(payload), json.RawMessage(payload)); !errors.Is(err, errMessageTooLarge) {
+		t.Fatalf("expected oversized ice message to be rejected, got %v", err)
+	}
+}
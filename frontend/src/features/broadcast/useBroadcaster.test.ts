@@ -1,6 +1,6 @@
 import { afterEach, describe, expect, it, vi } from 'vitest'
 
-import { buildSignalingUrl } from './useBroadcaster'
+import { buildSignalingUrl, parseSignalingError } from './useBroadcaster'
 
 const originalLocation = window.location
 
@@ -30,6 +30,14 @@ describe('buildSignalingUrl', () => {
     expect(result).toBe('ws://example.com/ws?token=abc&room=room&peer=peer')
   })
 
+  it('includes the signaling role when provided', () => {
+    vi.stubEnv('VITE_SIGNALING_WS_URL', 'ws://example.com/ws')
+
+    const result = buildSignalingUrl('room', 'peer', 'viewer')
+
+    expect(result).toBe('ws://example.com/ws?room=room&peer=peer&role=viewer')
+  })
+
   it('falls back to backend port 8080 when running on Vite dev server', () => {
     vi.unstubAllEnvs()
     Object.defineProperty(window, 'location', {
@@ -64,3 +72,28 @@ describe('buildSignalingUrl', () => {
     expect(result).toBe('wss://stream.example/ws?room=room&peer=peer')
   })
 })
+
+describe('parseSignalingError', () => {
+  it('reads the code, reference and details of structured errors', () => {
+    const result = parseSignalingError({
+      type: 'error',
+      code: 'target_not_found',
+      message: 'target peer not found',
+      ref: 'offer-1',
+      details: { type: 'offer', to: 'viewer-1' },
+    })
+
+    expect(result).toEqual({
+      code: 'target_not_found',
+      message: 'target peer not found',
+      ref: 'offer-1',
+      details: { type: 'offer', to: 'viewer-1' },
+    })
+  })
+
+  it('falls back to the text message of older servers', () => {
+    const result = parseSignalingError({ type: 'error', payload: { message: 'room closed' } })
+
+    expect(result).toEqual({ code: null, message: 'room closed', ref: null, details: null })
+  })
+})
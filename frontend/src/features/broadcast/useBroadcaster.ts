@@ -7,6 +7,11 @@ import { describeCloseEvent } from '../../lib/websocket'
 const logger = createLogger('useBroadcaster')
 
 const ICE_SERVERS: RTCIceServer[] = [{ urls: 'stun:stun.l.google.com:19302' }]
+const MAX_OFFER_ATTEMPTS = 3
+
+// Sent when gathering finishes so the peer, and the server's handshake timing,
+// know that no more candidates follow.
+export const END_OF_CANDIDATES: RTCIceCandidateInit = { candidate: '', sdpMLineIndex: 0 }
 
 type BroadcastPhase = 'idle' | 'preparing-media' | 'connecting' | 'ready'
 
@@ -16,12 +21,31 @@ type ViewerSummary = {
 }
 
 type SignalingMessage = {
+  id?: string
   type: string
   from?: string
   to?: string
   payload?: unknown
 }
 
+type PendingOffer = {
+  viewerId: string
+  attempt: number
+}
+
+type SignalingAck = {
+  id?: string
+  to?: string
+  status?: 'delivered' | 'dropped' | 'target-gone'
+}
+
+export type SignalingError = {
+  code: string | null
+  message: string | null
+  ref: string | null
+  details: { type?: string; to?: string } | null
+}
+
 interface UseBroadcasterOptions {
   room: string
   peerId: string
@@ -41,9 +65,15 @@ interface UseBroadcasterResult {
   toggleVideo: () => void
 }
 
-export function buildSignalingUrl(room: string, peerId: string) {
+export type SignalingRole = 'broadcaster' | 'viewer'
+
+export function buildSignalingUrl(room: string, peerId: string, role?: SignalingRole) {
   const base = (import.meta.env.VITE_SIGNALING_WS_URL as string | undefined)?.trim()
-  const query = new URLSearchParams({ room, peer: peerId }).toString()
+  const params = new URLSearchParams({ room, peer: peerId })
+  if (role) {
+    params.set('role', role)
+  }
+  const query = params.toString()
 
   if (base && base.length > 0) {
     const separator = base.includes('?') ? '&' : '?'
@@ -65,6 +95,31 @@ export function buildSignalingUrl(room: string, peerId: string) {
   return `${wsProtocol}://${hostname}:${port}/ws?${query}`
 }
 
+// parseSignalingError reads an error frame from the signaling server. Older
+// servers only send a text message, either at the top level or in payload.
+export function parseSignalingError(message: Record<string, unknown>): SignalingError {
+  const source =
+    typeof message.message === 'string' || typeof message.code === 'string'
+      ? message
+      : typeof message.payload === 'object' && message.payload
+        ? (message.payload as Record<string, unknown>)
+        : message
+
+  const text =
+    typeof source.message === 'string' && source.message.length > 0 ? source.message : null
+  const details =
+    typeof source.details === 'object' && source.details
+      ? (source.details as { type?: string; to?: string })
+      : null
+
+  return {
+    code: typeof source.code === 'string' ? source.code : null,
+    message: text,
+    ref: typeof source.ref === 'string' ? source.ref : null,
+    details,
+  }
+}
+
 export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroadcasterResult {
   const [phase, setPhase] = useState<BroadcastPhase>('idle')
   const [status, setStatus] = useState('準備待ち')
@@ -95,6 +150,10 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
   const streamRef = useRef<MediaStream | null>(null)
   const socketRef = useRef<WebSocket | null>(null)
   const connectionsRef = useRef(new Map<string, RTCPeerConnection>())
+  // offerTargetsRef maps the id of each sent offer to its viewer so that
+  // acks and server errors referencing the offer can be attributed.
+  const offerTargetsRef = useRef(new Map<string, PendingOffer>())
+  const offerSeqRef = useRef(0)
   const unmountedRef = useRef(false)
 
   const resetViewers = useCallback(() => {
@@ -105,6 +164,7 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
       pc.close()
     })
     connectionsRef.current.clear()
+    offerTargetsRef.current.clear()
     setViewers([])
   }, [])
 
@@ -175,6 +235,11 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
         pc.close()
         connectionsRef.current.delete(viewerId)
       }
+      offerTargetsRef.current.forEach((target, id) => {
+        if (target.viewerId === viewerId) {
+          offerTargetsRef.current.delete(id)
+        }
+      })
       updateViewerState(viewerId)
       logger.debug('viewer removed', viewerId, reason)
       logger.info(`viewer ${viewerId} disconnected (${reason})`)
@@ -249,11 +314,9 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
       })
 
       pc.onicecandidate = (event) => {
-        if (!event.candidate) {
-          return
-        }
         logger.debug('local ice candidate', viewerId, event.candidate)
-        sendMessage({ type: 'ice', to: viewerId, payload: event.candidate })
+        const payload = event.candidate ?? END_OF_CANDIDATES
+        sendMessage({ type: 'ice', to: viewerId, payload })
       }
 
       pc.onconnectionstatechange = () => {
@@ -276,6 +339,50 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
     [removeViewer, sendMessage, showError, updateViewerState],
   )
 
+  const sendOffer = useCallback(
+    (viewerId: string, offer: RTCSessionDescriptionInit, attempt: number) => {
+      offerSeqRef.current += 1
+      const offerId = `offer-${offerSeqRef.current}`
+      offerTargetsRef.current.set(offerId, { viewerId, attempt })
+      sendMessage({ id: offerId, type: 'offer', to: viewerId, payload: offer, ack: true })
+    },
+    [sendMessage],
+  )
+
+  const handleOfferAck = useCallback(
+    (ack: SignalingAck) => {
+      const pending = ack.id ? offerTargetsRef.current.get(ack.id) : undefined
+      if (!ack.id || !pending) {
+        return
+      }
+      offerTargetsRef.current.delete(ack.id)
+
+      const { viewerId, attempt } = pending
+      switch (ack.status) {
+        case 'delivered':
+          logger.debug('offer delivered', viewerId)
+          break
+        case 'dropped': {
+          const description = connectionsRef.current.get(viewerId)?.localDescription
+          if (description && attempt < MAX_OFFER_ATTEMPTS) {
+            logger.warn('offer dropped; retrying', viewerId, attempt)
+            sendOffer(viewerId, description, attempt + 1)
+            break
+          }
+          showError(`視聴者 ${viewerId} へのオファーを配送できませんでした`)
+          removeViewer(viewerId, 'offer dropped')
+          break
+        }
+        case 'target-gone':
+          removeViewer(viewerId, 'offer target gone')
+          break
+        default:
+          logger.debug('unknown ack status', ack)
+      }
+    },
+    [removeViewer, sendOffer, showError],
+  )
+
   const handleViewerJoin = useCallback(
     async (viewerId: string) => {
       logger.debug('viewer join requested', viewerId)
@@ -291,7 +398,7 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
         })
         logger.debug('local offer', viewerId)
         await pc.setLocalDescription(offer)
-        sendMessage({ type: 'offer', to: viewerId, payload: offer })
+        sendOffer(viewerId, offer, 1)
         setStatus('視聴者にオファーを送信しました')
       } catch (error) {
         logger.error('Failed to create offer', error)
@@ -299,7 +406,7 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
         removeViewer(viewerId, 'createOffer failed')
       }
     },
-    [createPeerConnection, removeViewer, sendMessage, showError],
+    [createPeerConnection, removeViewer, sendOffer, showError],
   )
 
   const handleMessage = useCallback(
@@ -341,24 +448,28 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
             removeViewer(sender, 'viewer requested disconnect')
           }
           break
-        case 'error': {
-          let description: string | null = null
-
-          if (typeof (message as { message?: unknown }).message === 'string') {
-            const directMessage = (message as { message?: string }).message
-            if (directMessage && directMessage.length > 0) {
-              description = directMessage
-            }
+        case 'ack':
+          if (typeof message.payload === 'object' && message.payload) {
+            handleOfferAck(message.payload as SignalingAck)
           }
-
-          if (!description && typeof message.payload === 'object' && message.payload) {
-            const payload = message.payload as { message?: unknown }
-            if (typeof payload.message === 'string' && payload.message.length > 0) {
-              description = payload.message
+          break
+        case 'error': {
+          const error = parseSignalingError(message as Record<string, unknown>)
+          const viewerId = error.ref ? offerTargetsRef.current.get(error.ref)?.viewerId : undefined
+
+          if (viewerId) {
+            logger.warn('offer rejected by signaling server', viewerId, error)
+            showError(
+              `視聴者 ${viewerId} へのオファー送信に失敗しました`,
+              error.message ?? error.code,
+            )
+            if (error.code === 'target_not_found' || error.code === 'delivery_failed') {
+              removeViewer(viewerId, `offer failed: ${error.code}`)
             }
+            break
           }
 
-          showError(description ?? 'シグナリングサーバからエラーを受信しました')
+          showError(error.message ?? 'シグナリングサーバからエラーを受信しました')
           break
         }
         default:
@@ -366,7 +477,14 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
           logger.info('Received unsupported signaling message', message)
       }
     },
-    [handleViewerAnswer, handleViewerIce, handleViewerJoin, removeViewer, showError],
+    [
+      handleOfferAck,
+      handleViewerAnswer,
+      handleViewerIce,
+      handleViewerJoin,
+      removeViewer,
+      showError,
+    ],
   )
 
   const start = useCallback(async () => {
@@ -409,7 +527,7 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
     setPhase('connecting')
     setStatus('シグナリングサーバへ接続中...')
 
-    const url = buildSignalingUrl(room, peerId)
+    const url = buildSignalingUrl(room, peerId, 'broadcaster')
     logger.debug('connecting to signaling server', url)
     const socket = new WebSocket(url)
     socketRef.current = socket
@@ -422,7 +540,7 @@ export function useBroadcaster({ room, peerId }: UseBroadcasterOptions): UseBroa
       logger.debug('socket opened')
       setPhase('ready')
       setStatus('接続しました。視聴者からの参加を待機しています。')
-      sendMessage({ type: 'broadcaster-ready' })
+      sendMessage({ type: 'broadcaster-ready', retain: true })
     }
 
     socket.onmessage = (event) => {
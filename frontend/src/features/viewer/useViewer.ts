@@ -3,12 +3,17 @@ import { useToast } from '../notifications/ToastContext'
 import { createLogger } from '../../lib/logger'
 import { describeError } from '../../lib/errors'
 import { describeCloseEvent } from '../../lib/websocket'
-import { buildSignalingUrl } from '../broadcast/useBroadcaster'
+import { buildSignalingUrl, END_OF_CANDIDATES } from '../broadcast/useBroadcaster'
 
 const logger = createLogger('useViewer')
 
 const ICE_SERVERS: RTCIceServer[] = [{ urls: 'stun:stun.l.google.com:19302' }]
 
+// How long to wait for the replayed broadcaster-ready before requesting an
+// offer from a broadcaster listed in the welcome roster. Retained messages are
+// not replayed across cluster nodes, or may have expired.
+const OFFER_FALLBACK_DELAY_MS = 1000
+
 type ViewerPhase = 'idle' | 'connecting' | 'waiting-offer' | 'answering' | 'watching'
 
 type SignalingMessage = {
@@ -45,6 +50,7 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
   const peerConnectionRef = useRef<RTCPeerConnection | null>(null)
   const streamRef = useRef<MediaStream | null>(null)
   const broadcasterRef = useRef<string | null>(null)
+  const offerFallbackRef = useRef<ReturnType<typeof setTimeout> | null>(null)
   const unmountedRef = useRef(false)
 
   const safeSetPhase = useCallback((value: ViewerPhase) => {
@@ -170,10 +176,44 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
     }
   }, [])
 
+  const cancelOfferFallback = useCallback(() => {
+    if (offerFallbackRef.current !== null) {
+      clearTimeout(offerFallbackRef.current)
+      offerFallbackRef.current = null
+    }
+  }, [])
+
   const requestOffer = useCallback(() => {
+    cancelOfferFallback()
     logger.debug('requesting offer from broadcaster')
     sendMessage({ type: 'viewer-ready' })
-  }, [sendMessage])
+  }, [cancelOfferFallback, sendMessage])
+
+  const handleWelcome = useCallback(
+    (payload: unknown) => {
+      const peers = (payload as { peers?: unknown } | undefined)?.peers
+      if (!Array.isArray(peers)) {
+        return
+      }
+      const hasBroadcaster = peers.some(
+        (peer) => (peer as { role?: unknown } | null)?.role === 'broadcaster',
+      )
+      if (!hasBroadcaster) {
+        return
+      }
+
+      cancelOfferFallback()
+      offerFallbackRef.current = setTimeout(() => {
+        offerFallbackRef.current = null
+        if (peerConnectionRef.current || unmountedRef.current) {
+          return
+        }
+        logger.debug('no broadcaster-ready replayed; requesting offer from roster broadcaster')
+        requestOffer()
+      }, OFFER_FALLBACK_DELAY_MS)
+    },
+    [cancelOfferFallback, requestOffer],
+  )
 
   const createPeerConnection = useCallback(() => {
     let pc = peerConnectionRef.current
@@ -202,16 +242,14 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
     }
 
     pc.onicecandidate = (event) => {
-      if (!event.candidate) {
-        return
-      }
       const broadcaster = broadcasterRef.current
       if (!broadcaster) {
         logger.debug('no broadcaster to send ice candidate')
         return
       }
       logger.debug('local ice candidate', event.candidate)
-      sendMessage({ type: 'ice', to: broadcaster, payload: event.candidate })
+      const payload = event.candidate ?? END_OF_CANDIDATES
+      sendMessage({ type: 'ice', to: broadcaster, payload })
     }
 
     pc.onconnectionstatechange = () => {
@@ -267,6 +305,7 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
         return
       }
 
+      cancelOfferFallback()
       const pc = createPeerConnection()
       broadcasterRef.current = sender
 
@@ -295,6 +334,7 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
       }
     },
     [
+      cancelOfferFallback,
       cleanupPeerConnection,
       createPeerConnection,
       reportError,
@@ -344,6 +384,9 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
 
       const sender = message.from
       switch (message.type) {
+        case 'welcome':
+          handleWelcome(message.payload)
+          break
         case 'offer':
           if (sender) {
             void handleOffer(sender, message.payload)
@@ -379,7 +422,15 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
           logger.debug('unsupported message type', message.type)
       }
     },
-    [handleBroadcasterLeft, handleOffer, handleRemoteIce, requestOffer, reportError, safeSetStatus],
+    [
+      handleBroadcasterLeft,
+      handleOffer,
+      handleRemoteIce,
+      handleWelcome,
+      requestOffer,
+      reportError,
+      safeSetStatus,
+    ],
   )
 
   const connect = useCallback(() => {
@@ -405,7 +456,7 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
     safeSetLastError(null)
     safeSetConnectionState(null)
 
-    const url = buildSignalingUrl(trimmedRoom, trimmedPeer)
+    const url = buildSignalingUrl(trimmedRoom, trimmedPeer, 'viewer')
     logger.debug('connecting to signaling server', url)
 
     const socket = new WebSocket(url)
@@ -417,9 +468,11 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
         socket.close()
         return
       }
+      // the server replays the broadcaster's retained broadcaster-ready, which
+      // triggers the offer request; the welcome roster covers the cases where
+      // nothing is replayed
       safeSetPhase('waiting-offer')
       safeSetStatus('配信者からのオファーを待機しています...')
-      requestOffer()
     }
 
     socket.onmessage = (event) => {
@@ -433,6 +486,7 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
 
     socket.onclose = (event) => {
       logger.debug('socket closed', event.code, event.reason)
+      cancelOfferFallback()
       cleanupPeerConnection()
       socketRef.current = null
       if (unmountedRef.current) {
@@ -451,13 +505,13 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
       }
     }
   }, [
+    cancelOfferFallback,
     cleanupPeerConnection,
     handleMessage,
     phase,
     peerId,
     reportError,
     reportWarning,
-    requestOffer,
     room,
     safeSetConnectionState,
     safeSetLastError,
@@ -471,11 +525,19 @@ export function useViewer({ room, peerId }: UseViewerOptions): UseViewerResult {
     if (socket && socket.readyState === WebSocket.OPEN) {
       sendMessage({ type: 'viewer-left' })
     }
+    cancelOfferFallback()
     cleanupPeerConnection()
     closeSocket()
     safeSetPhase('idle')
     safeSetStatus('視聴を終了しました')
-  }, [cleanupPeerConnection, closeSocket, safeSetPhase, safeSetStatus, sendMessage])
+  }, [
+    cancelOfferFallback,
+    cleanupPeerConnection,
+    closeSocket,
+    safeSetPhase,
+    safeSetStatus,
+    sendMessage,
+  ])
 
   useEffect(() => {
     unmountedRef.current = false